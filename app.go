@@ -3,31 +3,72 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
+	"net/url"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"DocuStore/search"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // App struct
 type App struct {
 	ctx    context.Context
-	engine *DocuEngine
+	config *Config
+	// held for reading by the bindings using the engine, and for writing
+	// while switching libraries
+	engineLock sync.RWMutex
+	engine     *DocuEngine
+	// why the engine could not be opened, returned by every binding
+	err error
+	// stops watching the folders of the library, and waits for it
+	stopWatching func()
+
+	searchLock sync.Mutex
+	// cancels the search in flight, superseded by the next one
+	cancelSearch context.CancelFunc
 }
 
 // NewApp creates a new App application struct
-func NewApp() *App {
-	return &App{}
+func NewApp(config *Config) *App {
+	return &App{config: config}
 }
 
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
-	engine, err := NewEngine()
+	engine, err := NewEngine(a.config)
 	if err != nil {
-		panic(err)
+		a.err = fmt.Errorf("the collection could not be opened: %w", err)
+		runtime.LogError(ctx, a.err.Error())
+		return
 	}
+	a.start(engine)
+}
+
+// start makes engine the current one and watches its folders.
+// a.engineLock must be held for writing, or not be needed yet.
+func (a *App) start(engine *DocuEngine) {
 	a.engine = engine
+	a.err = nil
+	err := engine.applySearchConfig(a.config)
+	if err != nil {
+		engine.log.Error(fmt.Sprintf("semantic search disabled: %s", err))
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		engine.WatchFolders(ctx)
+	}()
+	a.stopWatching = func() {
+		cancel()
+		<-done
+	}
 }
 
 // Decode base64-encoded input
@@ -43,15 +84,46 @@ func (a *App) decodeInput(encodedContent string) (string, error) {
 }
 
 func (a *App) AddURL(encodedURL string) error {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return a.err
+	}
 	var err error
 	content, err := a.decodeInput(encodedURL)
 	if err != nil {
 		return err
 	}
-	return a.engine.AddURL(content)
+	_, err = a.engine.AddURL(a.ctx, content)
+	return err
+}
+
+// Add a web page from its saved HTML, stored under the URL it came from
+func (a *App) AddHTML(encodedHTML string, encodedURL string) error {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return a.err
+	}
+	var err error
+	html, err := a.decodeInput(encodedHTML)
+	if err != nil {
+		return err
+	}
+	pageURL, err := a.decodeInput(encodedURL)
+	if err != nil {
+		return err
+	}
+	_, err = a.engine.AddHTML(a.ctx, []byte(html), pageURL)
+	return err
 }
 
 func (a *App) AddText(encodedText string, encodedTitle string) error {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return a.err
+	}
 	var err error
 	content, err := a.decodeInput(encodedText)
 	if err != nil {
@@ -61,15 +133,178 @@ func (a *App) AddText(encodedText string, encodedTitle string) error {
 	if err != nil {
 		return err
 	}
-	return a.engine.AddText(content, title)
+	_, err = a.engine.AddText(content, title)
+	return err
 }
 
-// Search a given query in the collection
+// Search a given query in the collection, cancelling the previous search if
+// it is still running
 func (a *App) Search(text string) ([]*search.SearchResult, error) {
-	return a.engine.QueryDocument(text)
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return nil, a.err
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	defer cancel()
+	a.searchLock.Lock()
+	if a.cancelSearch != nil {
+		a.cancelSearch()
+	}
+	a.cancelSearch = cancel
+	a.searchLock.Unlock()
+	return a.engine.QueryDocument(ctx, text)
 }
 
-// Read contents from a raw text file stored in the collection
-func (a *App) ReadTextFile(docID string) (string, error) {
+// Find documents similar to a stored one
+func (a *App) SimilarTo(docID string, k int) ([]*search.SearchResult, error) {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return nil, a.err
+	}
+	return a.engine.SimilarTo(a.ctx, docID, k)
+}
+
+// Read contents from a raw text file stored in the collection, or in
+// another library for results of SearchAllLibraries
+func (a *App) ReadTextFile(docID string, library string) (string, error) {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return "", a.err
+	}
+	if library != "" && library != a.config.Library {
+		return LoadLibraryText(a.config.DataDir, library, docID)
+	}
 	return a.engine.LoadText(docID)
 }
+
+// List clusters of documents with near-identical content
+func (a *App) Duplicates() ([][]*search.SearchResult, error) {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return nil, a.err
+	}
+	return a.engine.Duplicates(a.ctx)
+}
+
+// Open the archived snapshot of a web page in the default browser
+func (a *App) OpenSnapshot(docID string) error {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return a.err
+	}
+	path, err := a.engine.SnapshotFile(docID)
+	if err != nil {
+		return err
+	}
+	runtime.BrowserOpenURL(a.ctx, (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String())
+	return nil
+}
+
+// Start indexing the notes of a folder and keep them up to date
+func (a *App) AddWatchedFolder(folder string) error {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return a.err
+	}
+	return a.engine.AddWatchedFolder(a.ctx, folder)
+}
+
+// Stop watching a folder, keeping the notes already indexed
+func (a *App) RemoveWatchedFolder(folder string) error {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return a.err
+	}
+	return a.engine.RemoveWatchedFolder(folder)
+}
+
+func (a *App) ListWatchedFolders() ([]string, error) {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return nil, a.err
+	}
+	return a.engine.ListWatchedFolders()
+}
+
+func (a *App) ListLibraries() ([]string, error) {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	return ListLibraries(a.config.DataDir)
+}
+
+// Name of the library the collection is read from
+func (a *App) CurrentLibrary() string {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	return a.config.Library
+}
+
+// Create an empty library, without switching to it
+func (a *App) CreateLibrary(name string) error {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	return CreateLibrary(a.config.DataDir, strings.TrimSpace(name))
+}
+
+// Close the current library and open another one. The current library is
+// opened again if the other one cannot be opened.
+func (a *App) SwitchLibrary(name string) error {
+	// a running search would delay the switch
+	a.searchLock.Lock()
+	if a.cancelSearch != nil {
+		a.cancelSearch()
+	}
+	a.searchLock.Unlock()
+
+	a.engineLock.Lock()
+	defer a.engineLock.Unlock()
+	config := *a.config
+	config.Library = name
+	err := checkLibraryExists(config.DataDir, name)
+	if err != nil {
+		return err
+	}
+	// the current engine is closed first, so that its background work is
+	// over before the library, possibly the same one, is opened again
+	if a.engine != nil {
+		a.stopWatching()
+		a.engine.Close()
+		a.engine = nil
+	}
+	engine, err := NewEngine(&config)
+	if err != nil {
+		// back to the previous library
+		previous, reopenErr := NewEngine(a.config)
+		if reopenErr != nil {
+			a.err = fmt.Errorf("the collection could not be opened: %w", reopenErr)
+			return err
+		}
+		a.start(previous)
+		return err
+	}
+	a.config = &config
+	a.start(engine)
+	return nil
+}
+
+// Search a given query in every library
+func (a *App) SearchAllLibraries(text string) ([]*search.SearchResult, error) {
+	a.engineLock.RLock()
+	defer a.engineLock.RUnlock()
+	if a.engine == nil {
+		return nil, a.err
+	}
+	libraries, err := ListLibraries(a.config.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	return a.engine.SearchLibraries(a.ctx, a.config, libraries, text)
+}
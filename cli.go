@@ -0,0 +1,774 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"DocuStore/scraper"
+	"DocuStore/search"
+)
+
+const programName = "DocuStore"
+
+// command is a subcommand of the command line interface.
+type command struct {
+	name    string
+	args    string // synopsis of the arguments
+	summary string
+	// setup defines the flags of the command and returns the function
+	// running it with the arguments left after the flags
+	setup func(fs *flag.FlagSet) func(c *cli, args []string) error
+	// offered by shell completion after the command name
+	subcommands []string
+	// the command runs without opening the library
+	noLibrary bool
+}
+
+// cli holds what the commands of a run share.
+type cli struct {
+	ctx    context.Context
+	config *Config
+	engine *DocuEngine // nil for commands with noLibrary
+	out    io.Writer
+	// print JSON instead of text
+	json bool
+}
+
+// usageError reports invalid arguments. The command exits with code 2, as
+// for invalid flags.
+type usageError struct {
+	command *command
+	msg     string
+}
+
+func (e *usageError) Error() string {
+	if e.command == nil {
+		return fmt.Sprintf("%s, run '%s help' for the list of commands", e.msg, programName)
+	}
+	return fmt.Sprintf("%s\nusage: %s %s %s", e.msg, programName, e.command.name, e.command.args)
+}
+
+var commands []*command
+
+func init() {
+	// set here because the help and completion commands read the list
+	commands = []*command{
+		{name: "add", args: "[flags] <URL | FILE | FOLDER>", summary: "add a web page, a file or every text file of a folder", setup: addCommand},
+		{name: "query", args: "[flags] <QUERY>", summary: "search documents", setup: queryCommand},
+		{name: "similar", args: "[flags] <ID>", summary: "find documents similar to a stored one", setup: similarCommand},
+		{name: "list", args: "[flags]", summary: "list documents, newest first", setup: listCommand},
+		{name: "show", args: "[flags] <ID>", summary: "print a document and its content", setup: showCommand},
+		{name: "delete", args: "<ID>...", summary: "delete documents", setup: deleteCommand},
+		{name: "tag", args: "[-remove] <ID> <TAG>...", summary: "tag a document, or remove its tags", setup: tagCommand},
+		{name: "crawl", args: "[flags] <URL>", summary: "add the pages of a site", setup: crawlCommand},
+		{name: "duplicates", args: "[flags]", summary: "list groups of near-identical documents", setup: duplicatesCommand},
+		{name: "snapshot", args: "<ID>", summary: "write the archived page of a document to a file", setup: snapshotCommand},
+		{name: "import", args: "[flags] <WARC>", summary: "add the HTML pages of a WARC file", setup: warcCommand("import")},
+		{name: "export", args: "[flags] <WARC>", summary: "write archived pages to a WARC file", setup: warcCommand("export")},
+		{name: "reindex", args: "", summary: "rebuild the index from the stored documents", setup: reindexCommand},
+		{name: "stats", args: "", summary: "describe the library", setup: statsCommand},
+		{name: "serve", args: "[flags]", summary: "serve the local REST API", setup: serveCommand},
+		{name: "native-host", args: "[flags]", summary: "run as the native messaging host of a browser extension", setup: nativeHostCommand},
+		{name: "watch", args: "[add <FOLDER> | remove <FOLDER> | list | sync]", summary: "keep folders of notes indexed", setup: watchCommand,
+			subcommands: []string{"add", "remove", "list", "sync"}},
+		{name: "library", args: "[list | create <NAME>]", summary: "list or create libraries", setup: libraryCommand, noLibrary: true,
+			subcommands: []string{"list", "create"}},
+		{name: "completion", args: "<bash | zsh | fish>", summary: "print a shell completion script", setup: completionCommand, noLibrary: true,
+			subcommands: []string{"bash", "zsh", "fish"}},
+		{name: "help", args: "[COMMAND]", summary: "describe the commands", setup: helpCommand, noLibrary: true},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flags of cmd and the function running it.
+func (cmd *command) flagSet(c *cli) (*flag.FlagSet, func(c *cli, args []string) error) {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.BoolVar(&c.json, "json", false, "print JSON instead of text")
+	run := cmd.setup(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s %s\n\n%s\n\nflags:\n", programName, cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs, run
+}
+
+// cliInterface runs the command given in args, writing its output to out.
+func cliInterface(config *Config, args []string, out io.Writer) error {
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return &usageError{msg: fmt.Sprintf("unknown command %q", args[0])}
+	}
+	c := &cli{config: config, out: out}
+	fs, run := cmd.flagSet(c)
+	// parse errors are reported by the caller, with the synopsis
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fs.SetOutput(out)
+		fs.Usage()
+		return nil
+	}
+	if err != nil {
+		return &usageError{command: cmd, msg: err.Error()}
+	}
+
+	// interrupting stops the command cleanly, a second interrupt exits right
+	// away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	c.ctx = ctx
+	if !cmd.noLibrary {
+		c.engine, err = NewEngine(config)
+		if err != nil {
+			return err
+		}
+		defer c.engine.Close()
+		err = c.engine.applySearchConfig(config)
+		if err != nil {
+			return err
+		}
+	}
+	return run(c, fs.Args())
+}
+
+// print writes v as JSON, or calls text to describe it.
+func (c *cli) print(v any, text func(w io.Writer)) error {
+	if !c.json {
+		text(c.out)
+		return nil
+	}
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// need returns a usage error unless there are n arguments or more.
+func need(cmd string, args []string, n int, what string) error {
+	if len(args) < n {
+		return &usageError{command: findCommand(cmd), msg: "missing " + what}
+	}
+	return nil
+}
+
+func addCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	htmlPath := fs.String("html", "", "HTML file of a page saved from -url")
+	pageURL := fs.String("url", "", "URL the HTML file was saved from")
+	var include, exclude stringList
+	fs.Var(&include, "include", "glob of the files to add from a directory (repeatable)")
+	fs.Var(&exclude, "exclude", "glob of the files to skip in a directory (repeatable)")
+	noGitignore := fs.Bool("no-gitignore", false, "also add files ignored by .gitignore")
+	return func(c *cli, args []string) error {
+		var docID string
+		var err error
+		if *htmlPath != "" {
+			if scraper.URLRegex.FindString(*pageURL) == "" {
+				return &usageError{command: findCommand("add"), msg: "missing the URL the page was saved from, given with -url"}
+			}
+			html, err := os.ReadFile(*htmlPath)
+			if err != nil {
+				return err
+			}
+			docID, err = c.engine.AddHTML(c.ctx, html, *pageURL)
+			return c.printAdded(docID, err)
+		}
+		if err := need("add", args, 1, "file path or URL"); err != nil {
+			return err
+		}
+		arg := args[0]
+		found := scraper.URLRegex.FindString(arg)
+		if info, err := os.Stat(arg); found == "" && err == nil && info.IsDir() {
+			opts := IngestOptions{Include: include, Exclude: exclude, Gitignore: !*noGitignore}
+			summary, err := c.engine.AddDirectory(c.ctx, arg, opts)
+			if err != nil {
+				return err
+			}
+			failed := make(map[string]string, len(summary.Failed))
+			for filePath, err := range summary.Failed {
+				failed[filePath] = err.Error()
+			}
+			return c.print(struct {
+				Added   int
+				Skipped int
+				Failed  map[string]string
+			}{summary.Added, summary.Skipped, failed}, func(w io.Writer) {
+				printIngestSummary(w, summary)
+			})
+		}
+		if found != "" {
+			docID, err = c.engine.AddURL(c.ctx, arg)
+		} else {
+			docID, err = c.engine.addFile(arg)
+		}
+		return c.printAdded(docID, err)
+	}
+}
+
+// printAdded prints the ID of a document that was added, or was already in
+// the collection. The latter still fails, for scripts to tell them apart.
+func (c *cli) printAdded(docID string, err error) error {
+	if err != nil && !errors.Is(err, ErrDuplicate) {
+		return err
+	}
+	duplicate := err != nil
+	printErr := c.print(map[string]any{"DocID": docID, "Duplicate": duplicate}, func(w io.Writer) {
+		if duplicate {
+			fmt.Fprintf(w, "already stored as %s\n", docID)
+		} else {
+			fmt.Fprintf(w, "added %s\n", docID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return printErr
+}
+
+func queryCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	mode := fs.String("mode", "", "lexical, semantic or hybrid (default hybrid with an embedding model)")
+	limit := fs.Int("limit", 10, "maximum number of results")
+	var libraries stringList
+	fs.Var(&libraries, "in", "library to search, instead of the open one (repeatable)")
+	all := fs.Bool("all", false, "search every library")
+	return func(c *cli, args []string) error {
+		if err := need("query", args, 1, "query"); err != nil {
+			return err
+		}
+		query := strings.Join(args, " ")
+		var err error
+		if *mode != "" {
+			err = c.engine.SetSearchMode(*mode)
+			if err != nil {
+				return err
+			}
+		}
+		if *all {
+			libraries, err = ListLibraries(c.config.DataDir)
+			if err != nil {
+				return err
+			}
+		}
+		var results []*search.SearchResult
+		if len(libraries) > 0 {
+			results, err = c.engine.SearchLibraries(c.ctx, c.config, libraries, query)
+		} else {
+			results, err = c.engine.QueryDocument(c.ctx, query)
+		}
+		if err != nil {
+			return err
+		}
+		return c.printResults(results, *limit)
+	}
+}
+
+// printResults prints the first limit results, or all of them if limit is
+// not positive.
+func (c *cli) printResults(results []*search.SearchResult, limit int) error {
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	if results == nil {
+		results = []*search.SearchResult{}
+	}
+	return c.print(results, func(w io.Writer) {
+		printSearchResults(w, results)
+	})
+}
+
+func similarCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	limit := fs.Int("limit", 5, "number of similar documents")
+	fs.IntVar(limit, "k", 5, "same as -limit")
+	return func(c *cli, args []string) error {
+		if err := need("similar", args, 1, "document ID"); err != nil {
+			return err
+		}
+		if *limit < 1 {
+			return &usageError{command: findCommand("similar"), msg: "-limit must be a positive number"}
+		}
+		docID, err := c.expandID(args[0])
+		if err != nil {
+			return err
+		}
+		results, err := c.engine.SimilarTo(c.ctx, docID, *limit)
+		if err != nil {
+			return err
+		}
+		return c.printResults(results, *limit)
+	}
+}
+
+func listCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	tag := fs.String("tag", "", "only list documents with this tag")
+	limit := fs.Int("limit", 0, "maximum number of documents (0 for no limit)")
+	return func(c *cli, args []string) error {
+		docs, err := c.engine.ListDocuments(*tag)
+		if err != nil {
+			return err
+		}
+		if *limit > 0 && len(docs) > *limit {
+			docs = docs[:*limit]
+		}
+		return c.print(docs, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			for _, doc := range docs {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", doc.DocID[:12], formatTimestamp(doc.Timestamp), doc.Type, doc.Title, strings.Join(doc.Tags, ","))
+			}
+			tw.Flush()
+		})
+	}
+}
+
+func formatTimestamp(ts int64) string {
+	return time.Unix(ts, 0).Format("2006-01-02 15:04")
+}
+
+// expandID returns the full ID of a document given by a prefix of its ID, as
+// printed by the list command.
+func (c *cli) expandID(prefix string) (string, error) {
+	docIDs, err := ListDocuments(c.engine.db)
+	if err != nil {
+		return "", err
+	}
+	var matches []string
+	for _, docID := range docIDs {
+		if docID == prefix {
+			return docID, nil
+		}
+		if strings.HasPrefix(docID, prefix) {
+			matches = append(matches, docID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrNotFound, prefix)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("ambiguous document ID %s", prefix)
+}
+
+func showCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	content := fs.Bool("content", true, "print the content of the document")
+	return func(c *cli, args []string) error {
+		if err := need("show", args, 1, "document ID"); err != nil {
+			return err
+		}
+		docID, err := c.expandID(args[0])
+		if err != nil {
+			return err
+		}
+		info, err := c.engine.DocumentInfo(docID)
+		if err != nil {
+			return err
+		}
+		var text string
+		if *content {
+			text, err = c.engine.LoadText(docID)
+			if err != nil {
+				return err
+			}
+		}
+		return c.print(struct {
+			*DocumentInfo
+			Content string `json:",omitempty"`
+		}{info, text}, func(w io.Writer) {
+			fmt.Fprintf(w, "ID: %s\nTitle: %s\nType: %s\n", info.DocID, info.Title, info.Type)
+			if info.Type == search.URL.String() {
+				fmt.Fprintf(w, "URL: %s\n", info.Identifier)
+			}
+			fmt.Fprintf(w, "Added: %s\n", formatTimestamp(info.Timestamp))
+			if len(info.Tags) > 0 {
+				fmt.Fprintf(w, "Tags: %s\n", strings.Join(info.Tags, ", "))
+			}
+			if *content {
+				fmt.Fprintf(w, "\n%s\n", text)
+			}
+		})
+	}
+}
+
+func deleteCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		if err := need("delete", args, 1, "document ID"); err != nil {
+			return err
+		}
+		deleted := []string{}
+		for _, arg := range args {
+			docID, err := c.expandID(arg)
+			if err == nil {
+				err = c.engine.DeleteDocument(docID)
+			}
+			if err != nil {
+				return err
+			}
+			deleted = append(deleted, docID)
+		}
+		return c.print(deleted, func(w io.Writer) {
+			for _, docID := range deleted {
+				fmt.Fprintf(w, "deleted %s\n", docID)
+			}
+		})
+	}
+}
+
+func tagCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	remove := fs.Bool("remove", false, "remove the tags instead of adding them")
+	return func(c *cli, args []string) error {
+		if err := need("tag", args, 2, "document ID and tags"); err != nil {
+			return err
+		}
+		docID, err := c.expandID(args[0])
+		if err != nil {
+			return err
+		}
+		if *remove {
+			err = c.engine.UntagDocument(docID, args[1:]...)
+		} else {
+			err = c.engine.TagDocument(docID, args[1:]...)
+		}
+		if err != nil {
+			return err
+		}
+		tags, err := LoadTags(c.engine.db, docID)
+		if err != nil {
+			return err
+		}
+		return c.print(map[string]any{"DocID": docID, "Tags": tags}, func(w io.Writer) {
+			fmt.Fprintf(w, "%s tags: %s\n", docID, strings.Join(tags, ", "))
+		})
+	}
+}
+
+func crawlCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	depth := fs.Int("depth", 1, "maximum number of links followed from the start page")
+	maxPages := fs.Int("max-pages", 100, "maximum number of pages to store (0 for no limit)")
+	sitemap := fs.Bool("sitemap", false, "read pages from sitemap.xml instead of following links")
+	delay := fs.Duration("delay", time.Second, "minimum delay between requests")
+	collection := fs.String("collection", "", "collection name (defaults to the start URL)")
+	return func(c *cli, args []string) error {
+		if len(args) == 0 || scraper.URLRegex.FindString(args[0]) == "" {
+			return &usageError{command: findCommand("crawl"), msg: "missing a valid URL"}
+		}
+		if !c.json {
+			fmt.Fprintln(c.out, "crawling", args[0])
+		}
+		opts := scraper.CrawlOptions{
+			MaxDepth:   *depth,
+			MaxPages:   *maxPages,
+			UseSitemap: *sitemap,
+			Delay:      *delay,
+		}
+		added, err := c.engine.Crawl(c.ctx, args[0], opts, *collection)
+		if err != nil {
+			return err
+		}
+		return c.print(map[string]int{"Stored": added}, func(w io.Writer) {
+			fmt.Fprintf(w, "%d new pages stored\n", added)
+		})
+	}
+}
+
+func duplicatesCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		clusters, err := c.engine.Duplicates(c.ctx)
+		if err != nil {
+			return err
+		}
+		if clusters == nil {
+			clusters = [][]*search.SearchResult{}
+		}
+		return c.print(clusters, func(w io.Writer) {
+			printDuplicates(w, clusters)
+		})
+	}
+}
+
+func snapshotCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		if err := need("snapshot", args, 1, "document ID"); err != nil {
+			return err
+		}
+		docID, err := c.expandID(args[0])
+		if err != nil {
+			return err
+		}
+		path, err := c.engine.SnapshotFile(docID)
+		if err != nil {
+			return err
+		}
+		return c.print(map[string]string{"Path": path}, func(w io.Writer) {
+			fmt.Fprintln(w, path)
+		})
+	}
+}
+
+func warcCommand(name string) func(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(fs *flag.FlagSet) func(c *cli, args []string) error {
+		collection := fs.String("collection", "", "collection of the pages")
+		return func(c *cli, args []string) error {
+			if err := need(name, args, 1, "WARC file path"); err != nil {
+				return err
+			}
+			if name == "import" {
+				added, duplicates, err := c.engine.ImportWARC(c.ctx, args[0], *collection)
+				if err != nil {
+					return err
+				}
+				return c.print(map[string]int{"Pages": added, "Duplicates": duplicates}, func(w io.Writer) {
+					fmt.Fprintf(w, "%d pages imported, %d already stored\n", added, duplicates)
+				})
+			}
+			n, err := c.engine.ExportWARC(c.ctx, args[0], *collection)
+			if err != nil {
+				return err
+			}
+			return c.print(map[string]int{"Pages": n}, func(w io.Writer) {
+				fmt.Fprintf(w, "%d pages exported\n", n)
+			})
+		}
+	}
+}
+
+func reindexCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		n, err := c.engine.Reindex()
+		if err != nil {
+			return err
+		}
+		return c.print(map[string]int{"Documents": n}, func(w io.Writer) {
+			fmt.Fprintf(w, "%d documents reindexed\n", n)
+		})
+	}
+}
+
+func statsCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		stats, err := c.engine.Stats()
+		if err != nil {
+			return err
+		}
+		return c.print(stats, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(tw, "Library:\t%s\n", stats.Library)
+			fmt.Fprintf(tw, "Data folder:\t%s\n", stats.DataFolder)
+			fmt.Fprintf(tw, "Documents:\t%d\n", stats.Documents)
+			types := make([]string, 0, len(stats.Types))
+			for docType := range stats.Types {
+				types = append(types, docType)
+			}
+			sort.Strings(types)
+			for _, docType := range types {
+				fmt.Fprintf(tw, "  %s:\t%d\n", docType, stats.Types[docType])
+			}
+			fmt.Fprintf(tw, "Terms:\t%d\n", stats.Terms)
+			fmt.Fprintf(tw, "Tags:\t%d\n", stats.Tags)
+			fmt.Fprintf(tw, "Watched folders:\t%d\n", stats.WatchedFolders)
+			fmt.Fprintf(tw, "Search mode:\t%s\n", stats.SearchMode)
+			if stats.EmbeddingModel != "" {
+				fmt.Fprintf(tw, "Embedding model:\t%s\n", stats.EmbeddingModel)
+			}
+			fmt.Fprintf(tw, "Disk size:\t%.1f MB\n", float64(stats.DiskSize)/(1<<20))
+			tw.Flush()
+		})
+	}
+}
+
+func serveCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	addr := fs.String("addr", defaultServerAddr, "loopback address to listen on")
+	token := fs.String("token", "", "API token (defaults to the one stored in the data folder)")
+	return func(c *cli, args []string) error {
+		var err error
+		if *token == "" {
+			*token, err = c.engine.apiToken()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "API token stored in %s\n", filepath.Join(c.engine.dataFolder, "api-token"))
+		}
+		return c.engine.Serve(c.ctx, *addr, *token)
+	}
+}
+
+func nativeHostCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	browser := fs.String("manifest", "", "print the host manifest for a browser (chrome or firefox) instead of running")
+	extensionID := fs.String("extension-id", "", "ID of the extension allowed to use the host")
+	return func(c *cli, args []string) error {
+		if *browser != "" {
+			manifest, err := nativeHostManifest(*browser, *extensionID)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(c.out, string(manifest))
+			return nil
+		}
+		return c.engine.RunNativeHost(c.ctx, os.Stdin, os.Stdout)
+	}
+}
+
+func watchCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "watching folders, press Ctrl-C to stop")
+			c.engine.WatchFolders(c.ctx)
+			return nil
+		}
+		switch args[0] {
+		case "add", "remove":
+			if err := need("watch", args, 2, "folder path"); err != nil {
+				return err
+			}
+			if args[0] == "add" {
+				return c.engine.AddWatchedFolder(c.ctx, args[1])
+			}
+			return c.engine.RemoveWatchedFolder(args[1])
+		case "list":
+			folders, err := c.engine.ListWatchedFolders()
+			if err != nil {
+				return err
+			}
+			if folders == nil {
+				folders = []string{}
+			}
+			return c.print(folders, func(w io.Writer) {
+				for _, folder := range folders {
+					fmt.Fprintln(w, folder)
+				}
+			})
+		case "sync":
+			return c.engine.SyncWatchedFolders(c.ctx)
+		}
+		return &usageError{command: findCommand("watch"), msg: fmt.Sprintf("unknown watch command %q", args[0])}
+	}
+}
+
+func libraryCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		if len(args) == 0 || args[0] == "list" {
+			libraries, err := ListLibraries(c.config.DataDir)
+			if err != nil {
+				return err
+			}
+			return c.print(map[string]any{"Libraries": libraries, "Current": c.config.Library}, func(w io.Writer) {
+				for _, name := range libraries {
+					if name == c.config.Library {
+						fmt.Fprintf(w, "* %s\n", name)
+					} else {
+						fmt.Fprintf(w, "  %s\n", name)
+					}
+				}
+			})
+		}
+		if args[0] != "create" {
+			return &usageError{command: findCommand("library"), msg: fmt.Sprintf("unknown library command %q", args[0])}
+		}
+		if err := need("library", args, 2, "library name"); err != nil {
+			return err
+		}
+		err := CreateLibrary(c.config.DataDir, args[1])
+		if err != nil {
+			return err
+		}
+		return c.print(map[string]string{"Library": args[1]}, func(w io.Writer) {
+			fmt.Fprintf(w, "library %s created, open it with -library %s\n", args[1], args[1])
+		})
+	}
+}
+
+func helpCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		if len(args) > 0 {
+			cmd := findCommand(args[0])
+			if cmd == nil {
+				return &usageError{msg: fmt.Sprintf("unknown command %q", args[0])}
+			}
+			fs, _ := cmd.flagSet(&cli{})
+			fs.SetOutput(c.out)
+			fs.Usage()
+			return nil
+		}
+		printUsage(c.out)
+		return nil
+	}
+}
+
+// printUsage describes the commands and the global flags.
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s [global flags] <command> [flags] [arguments]\n\n", programName)
+	fmt.Fprintf(w, "Without a command, the desktop app starts.\n\ncommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nglobal flags:\n")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+	fmt.Fprintf(w, "\nRun '%s help <command>' for the flags of a command. Every command accepts -json.\n", programName)
+}
+
+func printSearchResults(w io.Writer, sims []*search.SearchResult) {
+	fmt.Fprintf(w, "Here are the top %d matches:\n", len(sims))
+	for i, sim := range sims {
+		if sim.Score == 0.0 {
+			break
+		}
+		fmt.Fprintf(w, "Match: %d | Score: %.2f\n", i+1, sim.Score)
+		fmt.Fprintln(w, sim.Title)
+		if sim.Type == search.URL.String() {
+			fmt.Fprintln(w, sim.Identifier)
+		}
+		fmt.Fprintf(w, "ID: %s\n", sim.DocID)
+		if sim.Library != "" {
+			fmt.Fprintf(w, "Library: %s\n", sim.Library)
+		}
+		fmt.Fprintln(w, "--------------------------------------------")
+	}
+}
+
+func printDuplicates(w io.Writer, clusters [][]*search.SearchResult) {
+	if len(clusters) == 0 {
+		fmt.Fprintln(w, "No near-duplicate documents found")
+		return
+	}
+	for i, cluster := range clusters {
+		fmt.Fprintf(w, "Cluster %d\n", i+1)
+		for _, doc := range cluster {
+			fmt.Fprintf(w, "  %s | Similarity: %.2f\n", doc.Title, doc.Score)
+			if doc.Type == search.URL.String() {
+				fmt.Fprintf(w, "  %s\n", doc.Identifier)
+			}
+		}
+		fmt.Fprintln(w, "--------------------------------------------")
+	}
+}
+
+func printIngestSummary(w io.Writer, summary *IngestSummary) {
+	fmt.Fprintf(w, "%d files added, %d skipped, %d failed\n", summary.Added, summary.Skipped, len(summary.Failed))
+	failed := make([]string, 0, len(summary.Failed))
+	for filePath := range summary.Failed {
+		failed = append(failed, filePath)
+	}
+	sort.Strings(failed)
+	for _, filePath := range failed {
+		fmt.Fprintf(w, "  %s: %s\n", filePath, summary.Failed[filePath])
+	}
+}
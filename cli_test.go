@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"DocuStore/search"
+)
+
+// runCLI runs a command in the collection of config and returns its output.
+func runCLI(t *testing.T, config *Config, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := cliInterface(config, args, &out)
+	return out.String(), err
+}
+
+func TestCLI(t *testing.T) {
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	note := filepath.Join(t.TempDir(), "kestrel.md")
+	err := os.WriteFile(note, []byte("# Kestrel\nkestrels hover over fields\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCLI(t, config, "add", "-json", note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var added struct{ DocID string }
+	if err = json.Unmarshal([]byte(out), &added); err != nil || added.DocID == "" {
+		t.Fatalf("add printed %q: %v", out, err)
+	}
+	if _, err = runCLI(t, config, "add", note); exitCode(err) != exitDuplicate {
+		t.Errorf("adding a note again returned %v", err)
+	}
+
+	out, err = runCLI(t, config, "query", "-json", "-limit", "1", "hover", "kestrels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []*search.SearchResult
+	if err = json.Unmarshal([]byte(out), &results); err != nil || len(results) != 1 || results[0].DocID != added.DocID {
+		t.Errorf("query printed %q: %v", out, err)
+	}
+
+	// IDs may be shortened
+	prefix := added.DocID[:8]
+	if _, err = runCLI(t, config, "tag", prefix, "birds"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runCLI(t, config, "list", "-json", "-tag", "birds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []*DocumentInfo
+	if err = json.Unmarshal([]byte(out), &docs); err != nil || len(docs) != 1 || docs[0].Title != "Kestrel" {
+		t.Errorf("list printed %q: %v", out, err)
+	}
+	out, err = runCLI(t, config, "show", prefix)
+	if err != nil || !strings.Contains(out, "Tags: birds") || !strings.Contains(out, "kestrels hover") {
+		t.Errorf("show printed %q: %v", out, err)
+	}
+	if _, err = runCLI(t, config, "similar", prefix); err != nil {
+		t.Errorf("similar to a shortened ID returned %v", err)
+	}
+	out, err = runCLI(t, config, "stats", "-json")
+	var stats Stats
+	if err != nil || json.Unmarshal([]byte(out), &stats) != nil || stats.Documents != 1 || stats.Tags != 1 {
+		t.Errorf("stats printed %q: %v", out, err)
+	}
+	if out, err = runCLI(t, config, "reindex"); err != nil || out != "1 documents reindexed\n" {
+		t.Errorf("reindex printed %q: %v", out, err)
+	}
+
+	if _, err = runCLI(t, config, "delete", prefix); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = runCLI(t, config, "show", prefix); !errors.Is(err, ErrNotFound) || exitCode(err) != exitNotFound {
+		t.Errorf("showing a deleted document returned %v", err)
+	}
+
+	for _, args := range [][]string{{"query"}, {"bogus"}, {"query", "-bogus", "x"}, {"tag", prefix}, {"similar", "-limit", "-1", prefix}} {
+		if _, err = runCLI(t, config, args...); exitCode(err) != exitUsage {
+			t.Errorf("%v returned %v, expected a usage error", args, err)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		out, err := runCLI(t, config, "completion", shell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, word := range []string{"reindex", "limit", "data-dir"} {
+			if !strings.Contains(out, word) {
+				t.Errorf("%s completion lacks %s", shell, word)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func completionCommand(fs *flag.FlagSet) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		if err := need("completion", args, 1, "shell"); err != nil {
+			return err
+		}
+		switch args[0] {
+		case "bash":
+			writeBashCompletion(c.out)
+		case "zsh":
+			// zsh runs bash completion functions
+			fmt.Fprintln(c.out, "autoload -U +X bashcompinit && bashcompinit")
+			writeBashCompletion(c.out)
+		case "fish":
+			writeFishCompletion(c.out)
+		default:
+			return &usageError{command: findCommand("completion"), msg: fmt.Sprintf("unsupported shell %q", args[0])}
+		}
+		return nil
+	}
+}
+
+// completedFlag is a flag offered by shell completion.
+type completedFlag struct {
+	name  string
+	usage string
+	// the flag takes a value, given as the next argument
+	value bool
+}
+
+func completedFlags(fs *flag.FlagSet) []completedFlag {
+	var flags []completedFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completedFlag{
+			name:  f.Name,
+			usage: f.Usage,
+			value: !ok || !boolFlag.IsBoolFlag(),
+		})
+	})
+	return flags
+}
+
+// commandFlags returns the flags of cmd.
+func commandFlags(cmd *command) []completedFlag {
+	fs, _ := cmd.flagSet(&cli{})
+	return completedFlags(fs)
+}
+
+func writeBashCompletion(w io.Writer) {
+	var valueFlags, globalWords, names []string
+	for _, f := range completedFlags(flag.CommandLine) {
+		globalWords = append(globalWords, "-"+f.name)
+		if f.value {
+			valueFlags = append(valueFlags, "-"+f.name, "--"+f.name)
+		}
+	}
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	name := "_" + strings.ToLower(programName)
+	fmt.Fprintf(w, "%s() {\n", name)
+	fmt.Fprintf(w, "    local cur=${COMP_WORDS[COMP_CWORD]} cmd= i\n")
+	fmt.Fprintf(w, "    # the command is the first word that is neither a global flag nor its value\n")
+	fmt.Fprintf(w, "    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	fmt.Fprintf(w, "        case ${COMP_WORDS[i]} in\n")
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(w, "            %s) ((i++)) ;;\n", strings.Join(valueFlags, "|"))
+	}
+	fmt.Fprintf(w, "            -*) ;;\n")
+	fmt.Fprintf(w, "            *) cmd=${COMP_WORDS[i]}; break ;;\n")
+	fmt.Fprintf(w, "        esac\n")
+	fmt.Fprintf(w, "    done\n")
+	fmt.Fprintf(w, "    local words\n")
+	fmt.Fprintf(w, "    case $cmd in\n")
+	fmt.Fprintf(w, "        '') words=%q ;;\n", strings.Join(append(globalWords, names...), " "))
+	for _, cmd := range commands {
+		words := append([]string(nil), cmd.subcommands...)
+		for _, f := range commandFlags(cmd) {
+			words = append(words, "-"+f.name)
+		}
+		if cmd.name == "help" {
+			words = append(words, names...)
+		}
+		fmt.Fprintf(w, "        %s) words=%q ;;\n", cmd.name, strings.Join(words, " "))
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "    # other arguments are often files\n")
+	fmt.Fprintf(w, "    if [[ ${#COMPREPLY[@]} -eq 0 && $cur != -* ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F %s %s\n", name, programName)
+}
+
+func writeFishCompletion(w io.Writer) {
+	var names []string
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	prefix := "complete -c " + programName
+	for _, f := range completedFlags(flag.CommandLine) {
+		fmt.Fprintf(w, "%s -n __fish_use_subcommand -o %s%s -d %s\n", prefix, f.name, fishRequiresValue(f), fishQuote(f.usage))
+	}
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "%s -n __fish_use_subcommand -f -a %s -d %s\n", prefix, cmd.name, fishQuote(cmd.summary))
+	}
+	for _, cmd := range commands {
+		seen := "'__fish_seen_subcommand_from " + cmd.name + "'"
+		for _, f := range commandFlags(cmd) {
+			fmt.Fprintf(w, "%s -n %s -o %s%s -d %s\n", prefix, seen, f.name, fishRequiresValue(f), fishQuote(f.usage))
+		}
+		if len(cmd.subcommands) > 0 {
+			fmt.Fprintf(w, "%s -n %s -f -a %s\n", prefix, seen, fishQuote(strings.Join(cmd.subcommands, " ")))
+		}
+		if cmd.name == "help" {
+			fmt.Fprintf(w, "%s -n %s -f -a %s\n", prefix, seen, fishQuote(strings.Join(names, " ")))
+		}
+	}
+}
+
+func fishRequiresValue(f completedFlag) string {
+	if f.value {
+		return " -r"
+	}
+	return ""
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"DocuStore/scraper"
+	"DocuStore/search"
+
+	"github.com/BurntSushi/toml"
+	"github.com/adrg/xdg"
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+// environment variables overriding the configuration file
+const (
+	configEnv   = "DOCUSTORE_CONFIG"
+	dataDirEnv  = "DOCUSTORE_DATA_DIR"
+	logLevelEnv = "DOCUSTORE_LOG_LEVEL"
+	libraryEnv  = "DOCUSTORE_LIBRARY"
+	// path of the embedding model
+	embeddingModelEnv = "DOCUSTORE_EMBEDDING_MODEL"
+)
+
+// Config holds the settings of DocuStore. They are read from a TOML file,
+// then overridden by environment variables and command line flags.
+type Config struct {
+	DataDir string `toml:"data_dir"`
+	// library opened in the data folder, see ListLibraries
+	Library  string `toml:"library"`
+	LogLevel string `toml:"log_level"` // trace, debug, info, warning or error
+	LogFile  string `toml:"log_file"`  // logs go to stderr if empty
+	// word vector file enabling semantic search
+	EmbeddingModel   string `toml:"embedding_model"`
+	RefuseDuplicates bool   `toml:"refuse_duplicates"`
+	ArchiveResources bool   `toml:"archive_resources"`
+
+	Analyzer AnalyzerConfig `toml:"analyzer"`
+	Search   SearchConfig   `toml:"search"`
+	Fetcher  FetcherConfig  `toml:"fetcher"`
+}
+
+// AnalyzerConfig controls how text is split into tokens. Changes only apply
+// to documents added afterwards.
+type AnalyzerConfig struct {
+	MaxTokenLength int `toml:"max_token_length"`
+}
+
+// SearchConfig controls the ranking of documents.
+type SearchConfig struct {
+	Mode       string `toml:"mode"` // lexical, semantic or hybrid
+	MaxResults int    `toml:"max_results"`
+	// weight of the terms of each field: title, headings, url, description
+	// and body. The index is rebuilt when they change.
+	FieldBoosts map[string]float64 `toml:"field_boosts"`
+	HNSW        HNSWParams         `toml:"hnsw"`
+}
+
+// FetcherConfig controls how web pages are downloaded and scraped.
+type FetcherConfig struct {
+	Timeout   time.Duration `toml:"timeout"`
+	UserAgent string        `toml:"user_agent"`
+	// tags whose text is indexed
+	TextTags []string `toml:"text_tags"`
+}
+
+var fieldNames = map[string]search.Field{
+	"title":       search.TitleField,
+	"headings":    search.HeadingsField,
+	"url":         search.URLField,
+	"description": search.DescriptionField,
+	"body":        search.BodyField,
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() *Config {
+	boosts := make(map[string]float64, len(fieldNames))
+	for name, field := range fieldNames {
+		boosts[name] = search.DefaultFieldBoosts[field]
+	}
+	return &Config{
+		DataDir:  filepath.Join(xdg.StateHome, "DocuStore"),
+		LogLevel: "debug",
+		Library:  defaultLibrary,
+		Analyzer: AnalyzerConfig{MaxTokenLength: search.DefaultMaxTokenLength},
+		Search: SearchConfig{
+			MaxResults:  maxResults,
+			FieldBoosts: boosts,
+			HNSW:        DefaultHNSWParams,
+		},
+		Fetcher: FetcherConfig{
+			Timeout:   scraper.DefaultScrapeOptions.Timeout,
+			UserAgent: scraper.DefaultScrapeOptions.UserAgent,
+			TextTags:  scraper.DefaultScrapeOptions.TextTags,
+		},
+	}
+}
+
+// defaultConfigPath is the configuration file read when none is given.
+func defaultConfigPath() string {
+	return filepath.Join(xdg.ConfigHome, "DocuStore", "config.toml")
+}
+
+// LoadConfig reads the configuration file at path, or the default one if
+// path is empty, and applies the environment variables. Only an explicitly
+// given file is required to exist.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	if path == "" {
+		path = os.Getenv(configEnv)
+	}
+	required := path != ""
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	_, err := toml.DecodeFile(path, config)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading configuration: %w", err)
+	}
+
+	if value := os.Getenv(dataDirEnv); value != "" {
+		config.DataDir = value
+	}
+	if value := os.Getenv(libraryEnv); value != "" {
+		config.Library = value
+	}
+	if value := os.Getenv(logLevelEnv); value != "" {
+		config.LogLevel = value
+	}
+	if value := os.Getenv(embeddingModelEnv); value != "" {
+		config.EmbeddingModel = value
+	}
+	return config, config.validate()
+}
+
+// configFlags are the global command line flags overriding the configuration.
+type configFlags struct {
+	config           *string
+	dataDir          *string
+	library          *string
+	logLevel         *string
+	embeddingModel   *string
+	refuseDuplicates *bool
+	archiveResources *bool
+}
+
+func registerConfigFlags(fs *flag.FlagSet) *configFlags {
+	return &configFlags{
+		config:           fs.String("config", "", "configuration file (default "+defaultConfigPath()+")"),
+		dataDir:          fs.String("data-dir", "", "folder of the collection, to keep separate collections"),
+		library:          fs.String("library", "", "library of the data folder to open (default \"default\")"),
+		logLevel:         fs.String("log-level", "", "trace, debug, info, warning or error"),
+		embeddingModel:   fs.String("embedding-model", "", "word vector file (.vec or .txt, optionally gzipped) enabling semantic search"),
+		refuseDuplicates: fs.Bool("refuse-duplicates", false, "refuse to add documents nearly identical to stored ones"),
+		archiveResources: fs.Bool("archive-resources", false, "embed stylesheets and images in archived web pages"),
+	}
+}
+
+// load reads the configuration and applies the flags set in fs.
+func (f *configFlags) load(fs *flag.FlagSet) (*Config, error) {
+	config, err := LoadConfig(*f.config)
+	if err != nil {
+		return nil, err
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "data-dir":
+			config.DataDir = *f.dataDir
+		case "library":
+			config.Library = *f.library
+		case "log-level":
+			config.LogLevel = *f.logLevel
+		case "embedding-model":
+			config.EmbeddingModel = *f.embeddingModel
+		case "refuse-duplicates":
+			config.RefuseDuplicates = *f.refuseDuplicates
+		case "archive-resources":
+			config.ArchiveResources = *f.archiveResources
+		}
+	})
+	return config, config.validate()
+}
+
+func (c *Config) validate() error {
+	if strings.HasPrefix(c.DataDir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		c.DataDir = filepath.Join(home, c.DataDir[2:])
+	}
+	if c.DataDir == "" {
+		return errors.New("the data folder must be set")
+	}
+	err := checkLibraryName(c.Library)
+	if err != nil {
+		return err
+	}
+	_, err = logger.StringToLogLevel(c.LogLevel)
+	if err != nil {
+		return err
+	}
+	switch c.Search.Mode {
+	case "", LexicalSearch, SemanticSearch, HybridSearch:
+	default:
+		return fmt.Errorf("unknown search mode: %s", c.Search.Mode)
+	}
+	for name, boost := range c.Search.FieldBoosts {
+		if _, ok := fieldNames[name]; !ok {
+			return fmt.Errorf("unknown field in field_boosts: %s", name)
+		}
+		if boost <= 0 {
+			return fmt.Errorf("the boost of the %s field must be positive", name)
+		}
+	}
+	if c.Analyzer.MaxTokenLength < 1 || c.Search.MaxResults < 1 {
+		return errors.New("max_token_length and max_results must be positive")
+	}
+	if c.Search.HNSW.M < 2 || c.Search.HNSW.EfConstruction < 1 || c.Search.HNSW.EfSearch < 1 {
+		return errors.New("hnsw parameters must be positive, and m at least 2")
+	}
+	return nil
+}
+
+// analyzer returns the settings of the tokenizer.
+func (c *Config) analyzer() search.Analyzer {
+	return search.Analyzer{MaxTokenLength: c.Analyzer.MaxTokenLength}
+}
+
+// fieldBoosts returns the weights of the fields of documents.
+func (c *Config) fieldBoosts() search.FieldBoosts {
+	boosts := make(search.FieldBoosts, len(fieldNames))
+	for name, field := range fieldNames {
+		boosts[field] = search.DefaultFieldBoosts[field]
+		if boost, ok := c.Search.FieldBoosts[name]; ok {
+			boosts[field] = boost
+		}
+	}
+	return boosts
+}
+
+// scrapeOptions returns the settings of the scraper.
+func (c *Config) scrapeOptions() scraper.ScrapeOptions {
+	return scraper.ScrapeOptions{
+		Timeout:   c.Fetcher.Timeout,
+		UserAgent: c.Fetcher.UserAgent,
+		TextTags:  c.Fetcher.TextTags,
+	}
+}
+
+// newLogger returns a logger writing messages of the configured level and
+// above.
+func (c *Config) newLogger() logger.Logger {
+	level, _ := logger.StringToLogLevel(c.LogLevel)
+	var log logger.Logger = logger.NewDefaultLogger()
+	if c.LogFile != "" {
+		log = logger.NewFileLogger(c.LogFile)
+	}
+	return &levelLogger{Logger: log, level: level}
+}
+
+// levelLogger drops the messages below a level.
+type levelLogger struct {
+	logger.Logger
+	level logger.LogLevel
+}
+
+func (l *levelLogger) Trace(message string) {
+	if l.level <= logger.TRACE {
+		l.Logger.Trace(message)
+	}
+}
+
+func (l *levelLogger) Debug(message string) {
+	if l.level <= logger.DEBUG {
+		l.Logger.Debug(message)
+	}
+}
+
+func (l *levelLogger) Info(message string) {
+	if l.level <= logger.INFO {
+		l.Logger.Info(message)
+	}
+}
+
+func (l *levelLogger) Warning(message string) {
+	if l.level <= logger.WARNING {
+		l.Logger.Warning(message)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"DocuStore/search"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+data_dir = "/tmp/project"
+log_level = "warning"
+
+[search]
+max_results = 20
+field_boosts = { title = 5 }
+
+[fetcher]
+timeout = "5s"
+`)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.DataDir != "/tmp/project" || config.LogLevel != "warning" || config.Search.MaxResults != 20 {
+		t.Errorf("settings not read: %+v", config)
+	}
+	if config.Fetcher.Timeout != 5*time.Second {
+		t.Errorf("timeout %s, expected 5s", config.Fetcher.Timeout)
+	}
+	// unset values keep their default
+	if config.Search.FieldBoosts["title"] != 5 || config.Search.FieldBoosts["headings"] != 2 {
+		t.Errorf("field boosts %v", config.Search.FieldBoosts)
+	}
+	if config.Fetcher.UserAgent == "" || config.Search.HNSW != DefaultHNSWParams {
+		t.Errorf("defaults lost: %+v", config)
+	}
+
+	t.Setenv(dataDirEnv, "/tmp/other")
+	config, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.DataDir != "/tmp/other" {
+		t.Errorf("environment ignored, data folder %s", config.DataDir)
+	}
+
+	if _, err = LoadConfig(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Error("a missing configuration file was accepted")
+	}
+	for _, content := range []string{
+		`log_level = "loud"`,
+		`[search]
+mode = "fuzzy"`,
+		`[search.field_boosts]
+footer = 2`,
+		`[analyzer]
+max_token_length = 0`,
+	} {
+		if _, err = LoadConfig(writeConfig(t, content)); err == nil {
+			t.Errorf("invalid configuration accepted: %s", content)
+		}
+	}
+}
+
+func TestChangedBoostsRebuildIndex(t *testing.T) {
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = engine.AddText("the body mentions a kestrel", "birds")
+	if err == nil {
+		_, err = engine.AddText("nothing about birds here", "kestrel")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Close()
+
+	// with the body weighing more than the title, the first note ranks first
+	config.Search.FieldBoosts = map[string]float64{"title": 1, "body": 10}
+	engine, err = NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	results, err := engine.QueryDocument(context.Background(), "kestrel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Title != "birds" {
+		t.Errorf("index not rebuilt with the new boosts: %+v", results)
+	}
+	// fields missing from the table keep their default weight
+	boosts := config.fieldBoosts()
+	if boosts[search.HeadingsField] != search.DefaultFieldBoosts[search.HeadingsField] || boosts[search.BodyField] != 10 {
+		t.Errorf("partial field boosts %v", boosts)
+	}
+	if search.DefaultFieldBoosts[search.TitleField] != 3 {
+		t.Errorf("opening an engine changed the default boosts: %v", search.DefaultFieldBoosts)
+	}
+}
+
+func TestEngineAnalyzer(t *testing.T) {
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	config.Analyzer.MaxTokenLength = 6
+	short, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer short.Close()
+	// a library with its own settings, open at the same time
+	other := openTestEngine(t)
+	for _, engine := range []*DocuEngine{short, other} {
+		_, err = engine.AddText("configuration of the cluster", "settings")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	if results, err := short.QueryDocument(ctx, "configure"); err != nil || len(results) != 1 {
+		t.Errorf("tokens not truncated: %v, %v", results, err)
+	}
+	if results, err := other.QueryDocument(ctx, "configure"); err != nil || len(results) != 0 {
+		t.Errorf("the analyzer of another engine was used: %v, %v", results, err)
+	}
+}
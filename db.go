@@ -4,7 +4,15 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"DocuStore/search"
 
@@ -18,7 +26,22 @@ func NewDBConnection(dbPath string) (*sql.DB, error) {
 		return nil, err
 	}
 	err = createTables(db)
-	return db, err
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewReadOnlyDBConnection opens an existing database without creating or
+// changing anything. If there is none, the error wraps os.ErrNotExist.
+func NewReadOnlyDBConnection(dbPath string) (*sql.DB, error) {
+	_, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	uri := &url.URL{Scheme: "file", Path: filepath.ToSlash(dbPath), RawQuery: "mode=ro"}
+	return sql.Open("sqlite3", uri.String())
 }
 
 func createTables(db *sql.DB) error {
@@ -27,6 +50,52 @@ func createTables(db *sql.DB) error {
 		return err
 	}
 	_, err = db.Exec("CREATE INDEX IF NOT EXISTS doc_timestamps ON documents (timestamp)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS collections (name TEXT, doc_id TEXT, PRIMARY KEY (name, doc_id))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS fingerprints (doc_id TEXT PRIMARY KEY, simhash INTEGER)")
+	if err != nil {
+		return err
+	}
+	// blocks of the fingerprints, to look up near-duplicates
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS fingerprint_bands (band INTEGER, value INTEGER, doc_id TEXT, PRIMARY KEY (band, value, doc_id))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS snapshots (doc_id TEXT PRIMARY KEY, url TEXT, timestamp INTEGER, html BLOB)")
+	if err != nil {
+		return err
+	}
+	// single-file views of archived pages, with their resources embedded
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS inlined_snapshots (doc_id TEXT PRIMARY KEY, html BLOB)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS tags (doc_id TEXT, tag TEXT, PRIMARY KEY (doc_id, tag))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS tag_names ON tags (tag)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS watched_folders (path TEXT PRIMARY KEY)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS watched_files (path TEXT PRIMARY KEY, folder TEXT, mtime INTEGER, hash TEXT, doc_id TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS watched_file_folders ON watched_files (folder)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS embeddings (doc_id TEXT, model TEXT, vector BLOB, PRIMARY KEY (doc_id, model))")
 	return err
 }
 
@@ -76,10 +145,373 @@ func insertDocTransaction(tx *sql.Tx, docSummary *search.DocSummary, content str
 	if err != nil {
 		return 0, err
 	}
+	if rows == 0 {
+		return rows, nil
+	}
 
+	err = insertFingerprint(tx, docSummary)
 	return rows, err
 }
 
+// insertFingerprint stores the fingerprint of a document and its bands.
+// Documents without terms all share the same fingerprint, they get none.
+func insertFingerprint(tx *sql.Tx, doc *search.DocSummary) error {
+	for _, table := range []string{"fingerprints", "fingerprint_bands"} {
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE doc_id = ?", doc.DocID)
+		if err != nil {
+			return err
+		}
+	}
+	if len(doc.TermFreqs) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(
+		"INSERT INTO fingerprints (doc_id, simhash) VALUES (?, ?)",
+		doc.DocID,
+		int64(doc.Fingerprint),
+	)
+	if err != nil {
+		return err
+	}
+	for band, value := range search.FingerprintBands(doc.Fingerprint, search.NearDuplicateDistance) {
+		_, err = tx.Exec(
+			"INSERT INTO fingerprint_bands (band, value, doc_id) VALUES (?, ?, ?)",
+			band,
+			int64(value),
+			doc.DocID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFingerprints returns the SimHash fingerprint of every document.
+func LoadFingerprints(db *sql.DB) (map[string]uint64, error) {
+	rows, err := db.Query("SELECT doc_id, simhash FROM fingerprints")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fingerprints := make(map[string]uint64)
+	for rows.Next() {
+		var docID string
+		var simhash int64
+		err = rows.Scan(&docID, &simhash)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints[docID] = uint64(simhash)
+	}
+	return fingerprints, rows.Err()
+}
+
+// LoadNearFingerprints returns the fingerprints sharing a band with
+// fingerprint, which include those at most search.NearDuplicateDistance bits
+// apart, ordered by document ID.
+func LoadNearFingerprints(db *sql.DB, fingerprint uint64) ([]string, []uint64, error) {
+	bands := search.FingerprintBands(fingerprint, search.NearDuplicateDistance)
+	conditions := make([]string, len(bands))
+	args := make([]any, 0, 2*len(bands))
+	for band, value := range bands {
+		conditions[band] = "(b.band = ? AND b.value = ?)"
+		args = append(args, band, int64(value))
+	}
+	rows, err := db.Query(
+		"SELECT DISTINCT f.doc_id, f.simhash FROM fingerprint_bands b JOIN fingerprints f ON f.doc_id = b.doc_id WHERE "+
+			strings.Join(conditions, " OR ")+" ORDER BY f.doc_id",
+		args...,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var docIDs []string
+	var fingerprints []uint64
+	for rows.Next() {
+		var docID string
+		var simhash int64
+		err = rows.Scan(&docID, &simhash)
+		if err != nil {
+			return nil, nil, err
+		}
+		docIDs = append(docIDs, docID)
+		fingerprints = append(fingerprints, uint64(simhash))
+	}
+	return docIDs, fingerprints, rows.Err()
+}
+
+// AddToCollection groups an existing document under the named collection.
+func AddToCollection(db *sql.DB, name string, docID string) error {
+	_, err := db.Exec("INSERT OR IGNORE INTO collections (name, doc_id) VALUES (?, ?)", name, docID)
+	return err
+}
+
+// InsertSnapshot stores the raw HTML of a page fetched for a document,
+// replacing any previous snapshot, along with its single-file view if
+// inlined is not nil.
+func InsertSnapshot(db *sql.DB, docID string, url string, html []byte, inlined []byte, timestamp int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO snapshots (doc_id, url, timestamp, html) VALUES (?, ?, ?, ?)",
+		docID,
+		url,
+		timestamp,
+		html,
+	)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM inlined_snapshots WHERE doc_id = ?", docID)
+	}
+	if err == nil && inlined != nil {
+		_, err = tx.Exec("INSERT INTO inlined_snapshots (doc_id, html) VALUES (?, ?)", docID, inlined)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// LoadSnapshot returns the raw HTML of the archived page of a document and
+// the URL it was fetched from.
+func LoadSnapshot(db *sql.DB, docID string) ([]byte, string, error) {
+	row := db.QueryRow("SELECT html, url FROM snapshots WHERE doc_id = ?", docID)
+	var html []byte
+	var url string
+	err := row.Scan(&html, &url)
+	return html, url, err
+}
+
+// LoadInlinedSnapshot returns the single-file view of the archived page of a
+// document, sql.ErrNoRows if it has none.
+func LoadInlinedSnapshot(db *sql.DB, docID string) ([]byte, error) {
+	var html []byte
+	err := db.QueryRow("SELECT html FROM inlined_snapshots WHERE doc_id = ?", docID).Scan(&html)
+	return html, err
+}
+
+// EachSnapshot calls fn with the raw HTML of every archived page, restricted
+// to the named collection unless it is empty. Pages archived before the raw
+// HTML was kept are left out.
+func EachSnapshot(db *sql.DB, collection string, fn func(docID string, url string, timestamp int64, html []byte) error) error {
+	var rows *sql.Rows
+	var err error
+	if collection == "" {
+		rows, err = db.Query("SELECT doc_id, url, timestamp, html FROM snapshots WHERE html IS NOT NULL ORDER BY timestamp")
+	} else {
+		rows, err = db.Query(
+			"SELECT s.doc_id, s.url, s.timestamp, s.html FROM snapshots s JOIN collections c ON c.doc_id = s.doc_id WHERE c.name = ? AND s.html IS NOT NULL ORDER BY s.timestamp",
+			collection,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var docID, url string
+		var timestamp int64
+		var html []byte
+		err = rows.Scan(&docID, &url, &timestamp, &html)
+		if err != nil {
+			return err
+		}
+		err = fn(docID, url, timestamp, html)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DeleteDocument removes a document and everything stored about it.
+func DeleteDocument(db *sql.DB, docID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"documents", "fingerprints", "fingerprint_bands", "snapshots", "inlined_snapshots", "collections", "tags", "embeddings"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE doc_id = ?", docID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func AddTags(db *sql.DB, docID string, tags ...string) error {
+	for _, tag := range tags {
+		_, err := db.Exec("INSERT OR IGNORE INTO tags (doc_id, tag) VALUES (?, ?)", docID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RemoveTags(db *sql.DB, docID string, tags ...string) error {
+	for _, tag := range tags {
+		_, err := db.Exec("DELETE FROM tags WHERE doc_id = ? AND tag = ?", docID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadTags returns the tags of a document in alphabetical order.
+func LoadTags(db *sql.DB, docID string) ([]string, error) {
+	return queryStrings(db, "SELECT tag FROM tags WHERE doc_id = ? ORDER BY tag", docID)
+}
+
+// ListTaggedDocuments returns the IDs of the documents with the given tag.
+func ListTaggedDocuments(db *sql.DB, tag string) ([]string, error) {
+	return queryStrings(db, "SELECT doc_id FROM tags WHERE tag = ?", tag)
+}
+
+// CountTags returns the number of distinct tags.
+func CountTags(db *sql.DB) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(DISTINCT tag) FROM tags").Scan(&n)
+	return n, err
+}
+
+func queryStrings(db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]string, 0)
+	for rows.Next() {
+		var value string
+		err = rows.Scan(&value)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value)
+	}
+	return out, rows.Err()
+}
+
+func InsertWatchedFolder(db *sql.DB, folder string) error {
+	_, err := db.Exec("INSERT OR IGNORE INTO watched_folders (path) VALUES (?)", folder)
+	return err
+}
+
+// DeleteWatchedFolder stops tracking a folder and the files in it.
+func DeleteWatchedFolder(db *sql.DB, folder string) error {
+	_, err := db.Exec("DELETE FROM watched_files WHERE folder = ?", folder)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM watched_folders WHERE path = ?", folder)
+	return err
+}
+
+func ListWatchedFolders(db *sql.DB) ([]string, error) {
+	return queryStrings(db, "SELECT path FROM watched_folders ORDER BY path")
+}
+
+// LoadWatchedFiles returns the indexed state of the files of a watched
+// folder, by path.
+func LoadWatchedFiles(db *sql.DB, folder string) (map[string]*watchedFile, error) {
+	rows, err := db.Query("SELECT path, mtime, hash, doc_id FROM watched_files WHERE folder = ?", folder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := make(map[string]*watchedFile)
+	for rows.Next() {
+		file := &watchedFile{folder: folder}
+		err = rows.Scan(&file.path, &file.mtime, &file.hash, &file.docID)
+		if err != nil {
+			return nil, err
+		}
+		files[file.path] = file
+	}
+	return files, rows.Err()
+}
+
+func UpsertWatchedFile(db *sql.DB, file *watchedFile) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO watched_files (path, folder, mtime, hash, doc_id) VALUES (?, ?, ?, ?, ?)",
+		file.path,
+		file.folder,
+		file.mtime,
+		file.hash,
+		file.docID,
+	)
+	return err
+}
+
+func DeleteWatchedFile(db *sql.DB, path string) error {
+	_, err := db.Exec("DELETE FROM watched_files WHERE path = ?", path)
+	return err
+}
+
+// IsWatchedDocument reports whether a watched file other than exceptPath
+// was indexed as the given document.
+func IsWatchedDocument(db *sql.DB, docID string, exceptPath string) (bool, error) {
+	row := db.QueryRow("SELECT count(*) FROM watched_files WHERE doc_id = ? AND path != ?", docID, exceptPath)
+	var count int
+	err := row.Scan(&count)
+	return count > 0, err
+}
+
+func InsertEmbedding(db *sql.DB, docID string, model string, vector []float32) error {
+	blob := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(value))
+	}
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO embeddings (doc_id, model, vector) VALUES (?, ?, ?)",
+		docID,
+		model,
+		blob,
+	)
+	return err
+}
+
+// LoadEmbeddings returns the vectors computed by a model, by document ID.
+func LoadEmbeddings(db *sql.DB, model string) (map[string][]float32, error) {
+	rows, err := db.Query("SELECT doc_id, vector FROM embeddings WHERE model = ?", model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	vectors := make(map[string][]float32)
+	for rows.Next() {
+		var docID string
+		var blob []byte
+		err = rows.Scan(&docID, &blob)
+		if err != nil {
+			return nil, err
+		}
+		vector := make([]float32, len(blob)/4)
+		for i := range vector {
+			vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+		}
+		vectors[docID] = vector
+	}
+	return vectors, rows.Err()
+}
+
+// ListUnembeddedDocuments returns the IDs of the documents without a vector
+// computed by model.
+func ListUnembeddedDocuments(db *sql.DB, model string) ([]string, error) {
+	return queryStrings(
+		db,
+		"SELECT doc_id FROM documents WHERE doc_id NOT IN (SELECT doc_id FROM embeddings WHERE model = ?)",
+		model,
+	)
+}
+
 func GetLatestTimestamp(db *sql.DB) (int64, error) {
 	row := db.QueryRow("SELECT coalesce(max(timestamp), 0) FROM documents")
 	var timestamp int64
@@ -108,6 +540,9 @@ func LoadText(db *sql.DB, docID string) (string, error) {
 	row := db.QueryRow("SELECT content FROM documents WHERE doc_id = ?", docID)
 	var byteContent []byte
 	err := row.Scan(&byteContent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
 	if err != nil {
 		return "", err
 	}
@@ -116,38 +551,47 @@ func LoadText(db *sql.DB, docID string) (string, error) {
 }
 
 func LoadDocSummary(db *sql.DB, docID string) (*search.DocSummary, int64, error) {
-	row := db.QueryRow("SELECT summary, timestamp FROM documents WHERE doc_id = ?", docID)
+	return loadDocSummary(context.Background(), db, docID)
+}
+
+func loadDocSummary(ctx context.Context, db *sql.DB, docID string) (*search.DocSummary, int64, error) {
+	row := db.QueryRowContext(ctx, "SELECT summary, timestamp FROM documents WHERE doc_id = ?", docID)
 	var blob []byte
 	var ts int64
 	err := row.Scan(&blob, &ts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ts, ErrNotFound
+	}
 	if err != nil {
 		return nil, ts, err
 	}
 	buffer := bytes.NewBuffer(blob)
 	decoder := gob.NewDecoder(buffer)
 	docSummary := search.DocSummary{}
-	decoder.Decode(&docSummary)
-	return &docSummary, ts, err
+	err = decoder.Decode(&docSummary)
+	if err != nil {
+		return nil, ts, fmt.Errorf("%w: summary of %s: %s", ErrCorrupted, docID, err)
+	}
+	return &docSummary, ts, nil
 }
 
+// maximum number of summaries loaded at once by LoadDocSummaries
+const loadConcurrency = 8
+
 func LoadDocSummaries(ctx context.Context, db *sql.DB, docIDs ...string) ([]*search.DocSummary, error) {
 	errs, ctx := errgroup.WithContext(ctx)
+	errs.SetLimit(loadConcurrency)
 	out := make([]*search.DocSummary, len(docIDs))
 	for i := 0; i < len(docIDs); i++ {
 		current := i
 		errs.Go(
 			func() error {
-				doc, _, err := LoadDocSummary(db, docIDs[current])
+				doc, _, err := loadDocSummary(ctx, db, docIDs[current])
 				if err != nil {
 					return err
 				}
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-					out[current] = doc
-					return nil
-				}
+				out[current] = doc
+				return nil
 			},
 		)
 	}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"DocuStore/search"
+	"DocuStore/semantic"
+)
+
+// Search modes
+const (
+	LexicalSearch  = "lexical"
+	SemanticSearch = "semantic"
+	HybridSearch   = "hybrid"
+)
+
+// number of nearest neighbors ranked by semantic search
+const semanticCandidates = 50
+
+// EnableEmbeddings loads the word vector model at modelPath. Queries then
+// combine lexical and semantic ranking, unless another search mode is set.
+// The vectors of the documents stored without one are computed in the
+// background, until then these documents are only found by keywords.
+func (e *DocuEngine) EnableEmbeddings(modelPath string) error {
+	model, err := semantic.LoadWordVectors(modelPath)
+	if err != nil {
+		return err
+	}
+	return e.useEmbedder(model)
+}
+
+// useEmbedder enables embeddings with a model that is already loaded.
+func (e *DocuEngine) useEmbedder(model semantic.Embedder) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// the index of the previous model
+	err := e.saveVectors()
+	if err != nil {
+		return err
+	}
+	vectorsPath := filepath.Join(e.dataFolder, "hnsw-"+model.ID()+".gob")
+	index, err := e.loadVectorIndex(vectorsPath, model.ID())
+	if err != nil {
+		return err
+	}
+	e.embedder = model
+	e.vectors = index
+	e.vectorsPath = vectorsPath
+	if e.searchMode == "" {
+		e.searchMode = HybridSearch
+	}
+	if e.readOnly {
+		// documents without a vector are only found by keywords
+		return nil
+	}
+
+	missing, err := ListUnembeddedDocuments(e.db, model.ID())
+	if err != nil {
+		return err
+	}
+	if e.stopEmbeddings != nil {
+		e.stopEmbeddings()
+	}
+	if len(missing) > 0 {
+		e.log.Info(fmt.Sprintf("computing embeddings of %d documents", len(missing)))
+		ctx, cancel := context.WithCancel(context.Background())
+		e.stopEmbeddings = cancel
+		e.embeddings.Add(1)
+		go func() {
+			defer e.embeddings.Done()
+			err := e.embedMissing(ctx, model, missing)
+			if err != nil && ctx.Err() == nil {
+				e.log.Warning(fmt.Sprintf("error computing embeddings: %s", err))
+			}
+		}()
+	}
+	return nil
+}
+
+// embedMissing computes the vectors of documents stored before model was
+// enabled, one document at a time so that adds and queries are not held up.
+func (e *DocuEngine) embedMissing(ctx context.Context, model semantic.Embedder, docIDs []string) error {
+	for _, docID := range docIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		content, err := LoadText(e.db, docID)
+		if errors.Is(err, ErrNotFound) {
+			// deleted since
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		vector, err := model.Embed(content)
+		if err != nil {
+			return err
+		}
+		err = e.insertEmbedding(model, docID, vector)
+		if err != nil {
+			return err
+		}
+	}
+	e.log.Info(fmt.Sprintf("computed embeddings of %d documents", len(docIDs)))
+	return nil
+}
+
+// insertEmbedding stores the vector of a document computed in the
+// background, unless the document was deleted or the model changed since.
+func (e *DocuEngine) insertEmbedding(model semantic.Embedder, docID string, vector []float32) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.embedder != model {
+		return nil
+	}
+	_, _, err := LoadDocSummary(e.db, docID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = InsertEmbedding(e.db, docID, model.ID(), vector)
+	if err != nil {
+		return err
+	}
+	e.vectors.Insert(docID, vector)
+	e.scheduleVectorSave()
+	return nil
+}
+
+// loadVectorIndex loads the ANN index of a model, rebuilding it from the
+// vectors stored in the database if it is missing or out of sync. The rebuilt
+// index is saved, unless the engine is read-only.
+func (e *DocuEngine) loadVectorIndex(path string, model string) (*HNSWIndex, error) {
+	vectors, err := LoadEmbeddings(e.db, model)
+	if err != nil {
+		return nil, err
+	}
+	index := NewHNSWIndex(e.hnswParams)
+	err = LoadStruct(path, index)
+	// A graph built with other links or construction effort is rebuilt,
+	// while the search effort only applies to queries.
+	if err == nil && index.Len() == len(vectors) &&
+		index.Params.M == e.hnswParams.M && index.Params.EfConstruction == e.hnswParams.EfConstruction {
+		index.Params.EfSearch = e.hnswParams.EfSearch
+		inSync := true
+		for docID := range vectors {
+			if index.Vector(docID) == nil {
+				inSync = false
+				break
+			}
+		}
+		if inSync {
+			return index, nil
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		e.log.Warning(fmt.Sprintf("Error reading vector index, rebuilding: %s", err))
+	}
+	index = NewHNSWIndex(e.hnswParams)
+	for docID, vector := range vectors {
+		index.Insert(docID, vector)
+	}
+	if e.readOnly {
+		return index, nil
+	}
+	return index, SaveStruct(path, index)
+}
+
+// applySearchConfig loads the embedding model of config, if any, and selects
+// its search mode.
+func (e *DocuEngine) applySearchConfig(config *Config) error {
+	if config.EmbeddingModel != "" {
+		err := e.EnableEmbeddings(config.EmbeddingModel)
+		if err != nil {
+			return err
+		}
+	}
+	if config.Search.Mode != "" {
+		return e.SetSearchMode(config.Search.Mode)
+	}
+	return nil
+}
+
+// SetSearchMode selects lexical, semantic or hybrid search. Semantic and
+// hybrid search need embeddings to be enabled.
+func (e *DocuEngine) SetSearchMode(mode string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch mode {
+	case LexicalSearch:
+	case SemanticSearch, HybridSearch:
+		if e.embedder == nil {
+			return fmt.Errorf("%s search needs an embedding model", mode)
+		}
+	default:
+		return fmt.Errorf("unknown search mode: %s", mode)
+	}
+	e.searchMode = mode
+	return nil
+}
+
+// embedDocument computes and stores the vector of a document, if embeddings
+// are enabled.
+func (e *DocuEngine) embedDocument(docID string, content string) error {
+	if e.embedder == nil {
+		return nil
+	}
+	vector, err := e.embedder.Embed(content)
+	if err != nil {
+		return err
+	}
+	err = InsertEmbedding(e.db, docID, e.embedder.ID(), vector)
+	if err != nil {
+		return err
+	}
+	e.vectors.Insert(docID, vector)
+	e.scheduleVectorSave()
+	return nil
+}
+
+// semanticSearch returns the k documents closest in meaning to text.
+func (e *DocuEngine) semanticSearch(ctx context.Context, text string, k int) ([]*search.SearchResult, error) {
+	query, err := e.embedder.Embed(text)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	e.vectorsLock.Lock()
+	neighbors := e.vectors.Search(query, k)
+	e.vectorsLock.Unlock()
+	var docIDs []string
+	for _, neighbor := range neighbors {
+		// unrelated, or a query without known words
+		if neighbor.Similarity <= 0 {
+			neighbors = neighbors[:len(docIDs)]
+			break
+		}
+		docIDs = append(docIDs, neighbor.DocID)
+	}
+	summaries := make(map[string]*search.DocSummary, len(docIDs))
+	for _, doc := range e.index.Summaries(docIDs...) {
+		summaries[doc.DocID] = doc
+	}
+	results := make([]*search.SearchResult, 0, len(neighbors))
+	for _, neighbor := range neighbors {
+		doc, ok := summaries[neighbor.DocID]
+		if !ok {
+			continue
+		}
+		results = append(results, &search.SearchResult{
+			DocID:      doc.DocID,
+			Title:      doc.Title,
+			Identifier: doc.Identifier,
+			Type:       doc.Type.String(),
+			Score:      float64(neighbor.Similarity),
+		})
+	}
+	return results, nil
+}
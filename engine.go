@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/gob"
@@ -8,31 +9,81 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"DocuStore/markdown"
 	"DocuStore/scraper"
 	"DocuStore/search"
+	"DocuStore/semantic"
 
 	"github.com/adrg/xdg"
 	"github.com/wailsapp/wails/v2/pkg/logger"
 )
 
+// DocuEngine is safe for concurrent use. Searches run in parallel, and see
+// the collection before or after a change, never in the middle of one.
 type DocuEngine struct {
-	searcher   search.Searcher
+	// held for reading by searches and for writing by changes to the index,
+	// the vectors or the settings
+	mu sync.RWMutex
+	// the vector index keeps scratch space while searching
+	vectorsLock sync.Mutex
+	// folders are synced one at a time, so that a note is not indexed twice
+	watchLock sync.Mutex
+
+	searcher   search.TermSearcher
+	analyzer   search.Analyzer
+	boosts     search.FieldBoosts
 	log        logger.Logger
 	db         *sql.DB
-	index      *HashmapIndex
+	index      Index
 	docCounter *search.DocCounter
 	dataFolder string
+	library    string
+
+	// refuse near-duplicates instead of only warning about them
+	refuseNearDuplicates bool
+	// embed stylesheets and images in archived pages
+	archiveResources bool
+	scrapeOptions    scraper.ScrapeOptions
+	maxResults       int
+	hnswParams       HNSWParams
+
+	// nil unless embeddings are enabled
+	embedder    semantic.Embedder
+	vectors     VectorIndex
+	vectorsPath string
+	searchMode  string
+	// vectors of documents stored before the model was enabled are computed
+	// in the background
+	embeddings     sync.WaitGroup
+	stopEmbeddings context.CancelFunc
+	// the vector index is saved a while after it changes
+	vectorsChanged bool
+	vectorsSave    *time.Timer
+	// opened to search another library, nothing is written
+	readOnly bool
 }
 
-func NewEngine() (*DocuEngine, error) {
+// how long the vector index may stay unsaved after a change
+const vectorSaveDelay = 5 * time.Second
+
+// NewEngine opens the library of config in its data folder, creating the
+// default library if needed. The embedding model is loaded by
+// applySearchConfig.
+func NewEngine(config *Config) (*DocuEngine, error) {
 	gob.Register(search.DocSummary{})
-	stateDir := xdg.StateHome
-	dataFolder := filepath.Join(stateDir, "DocuStore")
-	log := logger.NewDefaultLogger()
+	log := config.newLogger()
+	err := checkLibraryExists(config.DataDir, config.Library)
+	if err != nil {
+		return nil, err
+	}
+	dataFolder := libraryFolder(config.DataDir, config.Library)
 	log.Debug(fmt.Sprintf("dataFolder: %s", dataFolder))
-	err := os.MkdirAll(dataFolder, 0755)
+	err = os.MkdirAll(dataFolder, 0755)
 	if err != nil {
 		return nil, err
 	}
@@ -41,250 +92,751 @@ func NewEngine() (*DocuEngine, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	index, err := loadIndex(dataFolder, db, log)
+	err = migrateDB(db, dataFolder, config.analyzer(), log)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	index, err := loadIndex(dataFolder, db, config.fieldBoosts(), log)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	docCounter, err := loadCounter(dataFolder, db, log)
+	engine, err := newEngine(config, config.Library, dataFolder, db, index, log)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
+	return engine, nil
+}
 
-	searcher, err := search.NewTFIDFSearcher(docCounter)
+// newEngine creates the engine of the library name, stored in dataFolder,
+// once its database and index are open.
+func newEngine(config *Config, name string, dataFolder string, db *sql.DB, index Index, log logger.Logger) (*DocuEngine, error) {
+	docCounter := index.Counter()
+	analyzer := config.analyzer()
+	boosts := config.fieldBoosts()
+	searcher, err := search.NewBoostedTFIDFSearcher(docCounter, analyzer, boosts)
 	if err != nil {
 		return nil, err
 	}
 	engine := &DocuEngine{
-		db:         db,
-		index:      index,
-		docCounter: docCounter,
-		searcher:   searcher,
-		dataFolder: dataFolder,
-		log:        log,
+		db:                   db,
+		index:                index,
+		docCounter:           docCounter,
+		searcher:             searcher,
+		analyzer:             analyzer,
+		boosts:               boosts,
+		dataFolder:           dataFolder,
+		library:              name,
+		log:                  log,
+		refuseNearDuplicates: config.RefuseDuplicates,
+		archiveResources:     config.ArchiveResources,
+		scrapeOptions:        config.scrapeOptions(),
+		maxResults:           config.Search.MaxResults,
+		hnswParams:           config.Search.HNSW,
 	}
 	return engine, nil
 }
 
-// Load or create Hashmap inverted index
-func loadIndex(dataFolder string, db *sql.DB, log logger.Logger) (*HashmapIndex, error) {
-	gob.Register(HashmapIndex{})
-	indexPath := filepath.Join(dataFolder, "index.gob")
+// folder of the inverted index segments in the data folder
+const indexFolder = "index"
+
+// Load or create the inverted index
+func loadIndex(dataFolder string, db *sql.DB, boosts search.FieldBoosts, log logger.Logger) (Index, error) {
+	indexPath := filepath.Join(dataFolder, indexFolder)
 	log.Debug(fmt.Sprintf("indexPath: %s", indexPath))
+	// index files of previous versions
+	for _, name := range []string{"index.gob", "postings.gob", "docCounter.gob"} {
+		os.Remove(filepath.Join(dataFolder, name))
+	}
 
-	index := &HashmapIndex{nil, 0}
 	latestTs, err := GetLatestTimestamp(db)
 	if err != nil {
-		return index, err
+		return nil, err
 	}
-	if latestTs == 0 {
+	index, err := OpenSegmentedIndex(indexPath, boosts, log)
+	if latestTs == 0 && (err == nil || errors.Is(err, os.ErrNotExist)) {
 		log.Debug("no documents in DB")
-		return index, nil
+		return index, index.Reset(NewInvertedIndex(), 0)
 	}
-
-	err = LoadStruct(indexPath, &index)
 	if err != nil {
-		log.Warning(fmt.Sprintf("Error reading BTree index, attempting to recover: %s", err))
-		index, err = recoverIndex(dataFolder, db)
+		log.Warning(fmt.Sprintf("Error reading inverted index, attempting to recover: %s", err))
+		err = recoverIndex(index, db, boosts)
 		if err != nil {
-			log.Error(fmt.Sprintf("BTree index recovery failed, documents may have been lost: %s", err))
+			log.Error(fmt.Sprintf("Inverted index recovery failed, documents may have been lost: %s", err))
 			return nil, err
 		}
-		log.Warning("BTree index succesfully recovered")
+		log.Warning("Inverted index succesfully recovered")
 	}
 
-	if index.Timestamp != latestTs {
-		log.Warning("BTree index is out of sync with latest changes, recovering")
-		log.Debug(fmt.Sprintf("timestamps: %+v - %+v\n", index.Timestamp, latestTs))
-		index, err = recoverIndex(dataFolder, db)
+	if index.Timestamp() != latestTs {
+		log.Warning("Inverted index is out of sync with latest changes, recovering")
+		log.Debug(fmt.Sprintf("timestamps: %+v - %+v\n", index.Timestamp(), latestTs))
+		err = recoverIndex(index, db, boosts)
 		if err != nil {
-			log.Error(fmt.Sprintf("BTree index recovery failed, documents may have been lost: %s", err))
+			log.Error(fmt.Sprintf("Inverted index recovery failed, documents may have been lost: %s", err))
 			return nil, err
 		}
-		log.Warning("BTree index succesfully recovered")
+		log.Warning("Inverted index succesfully recovered")
 	}
 	return index, nil
 }
 
-func recoverIndex(dataFolder string, db *sql.DB) (*HashmapIndex, error) {
+// recoverIndex rebuilds the index from the documents in the database,
+// weighing their fields with boosts.
+func recoverIndex(index Index, db *sql.DB, boosts search.FieldBoosts) error {
+	latestTs, err := GetLatestTimestamp(db)
+	if err != nil {
+		return err
+	}
 	docIDs, err := ListDocuments(db)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	btree := &HashmapIndex{nil, 0}
+	docs := NewInvertedIndex()
 	var doc *search.DocSummary
 	var ts int64
 	for _, docID := range docIDs {
 		doc, ts, err = LoadDocSummary(db, docID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		btree.InsertDoc(doc, ts)
+		docs.InsertDoc(doc, boosts, ts)
 	}
-	indexPath := filepath.Join(dataFolder, "index.gob")
-	err = SaveStruct(indexPath, btree)
+	return index.Reset(docs, latestTs)
+}
+
+func (e *DocuEngine) addFile(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return btree, nil
+	return e.addTextFile(string(content), filePath)
 }
 
-// Load or create DocCounter
-func loadCounter(dataFolder string, db *sql.DB, log logger.Logger) (*search.DocCounter, error) {
-	gob.Register(search.DocCounter{})
-	dcPath := filepath.Join(dataFolder, "docCounter.gob")
+// addTextFile stores the text read from a file and returns the document ID.
+// Markdown files are titled by their own title if they have one, other files
+// by their path.
+func (e *DocuEngine) addTextFile(text string, path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".mdx":
+		return e.addMarkdown(text, "", path)
+	}
+	return e.addDocument(text, text, path, search.DocType(search.Text))
+}
 
-	docCounter := search.NewDocCounter()
-	latestTs, err := GetLatestTimestamp(db)
+// AddText stores a Markdown or plain text document and returns its ID. The
+// title may be empty if the document has its own. If the document is already
+// stored, its ID is returned with ErrDuplicate.
+func (e *DocuEngine) AddText(text string, title string) (string, error) {
+	return e.addMarkdown(text, title, "")
+}
+
+// addMarkdown stores a Markdown document, indexing its plain text and keeping
+// the source as content. The document is titled by title, or else by its own
+// title, or else by defaultTitle. Tags in its front matter are applied.
+func (e *DocuEngine) addMarkdown(source string, title string, defaultTitle string) (string, error) {
+	note := markdown.Parse([]byte(source))
+	if title == "" {
+		title = note.Title
+	}
+	fields := markdownFields(note, title)
+	if title == "" {
+		title = defaultTitle
+	}
+	doc := e.analyzer.NewFieldDocSummary(fields, source, title, search.DocType(search.Text))
+	err := e.storeDocument(doc, source)
+	if err != nil && !errors.Is(err, ErrDuplicate) {
+		return "", err
+	}
+	if len(note.Tags) > 0 {
+		tagErr := e.TagDocument(doc.DocID, note.Tags...)
+		if tagErr != nil {
+			return "", tagErr
+		}
+	}
+	return doc.DocID, err
+}
+
+// markdownFields returns the fields indexed for a Markdown document.
+func markdownFields(note *markdown.Document, title string) map[search.Field]string {
+	if note.Text == "" {
+		return nil
+	}
+	return map[search.Field]string{
+		search.TitleField:    title,
+		search.HeadingsField: strings.Join(note.Headings, "\n"),
+		search.BodyField:     note.Text,
+	}
+}
+
+// AddURL stores the web page at url and returns its document ID. Pages that
+// cannot be fetched return a *scraper.FetchError.
+func (e *DocuEngine) AddURL(ctx context.Context, url string) (string, error) {
+	data, err := scraper.ScrapeText(ctx, url, e.scrapeOptions, e.log)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	if latestTs == 0 {
-		// no documents
-		return docCounter, nil
+	return e.addPage(ctx, url, data, e.archiveResources)
+}
+
+// AddHTML stores a page whose HTML was already fetched from url, such as a
+// page behind a login or saved for offline use, without accessing the
+// network. It returns the document ID.
+func (e *DocuEngine) AddHTML(ctx context.Context, html []byte, url string) (string, error) {
+	data, err := scraper.ExtractFromHTML(bytes.NewReader(html), url, e.scrapeOptions, e.log)
+	if err != nil {
+		return "", err
 	}
+	return e.addPage(ctx, url, data, false)
+}
 
-	err = LoadStruct(dcPath, docCounter)
+// addPage stores a scraped page and archives its snapshot, with a view
+// embedding the page resources if inline is true. It returns the document ID.
+func (e *DocuEngine) addPage(ctx context.Context, url string, data *scraper.ScrapeData, inline bool) (string, error) {
+	identifier, err := documentURL(url, data)
 	if err != nil {
-		log.Warning(fmt.Sprintf("Error reading DocCounter, attempting to recover: %s", err))
-		docCounter, err = recoverDocCounter(dataFolder, db)
+		return "", err
+	}
+	title := data.Title
+	if title == "" {
+		title = identifier
+	}
+	doc := e.analyzer.NewFieldDocSummary(pageFields(identifier, data), identifier, title, search.DocType(search.URL))
+	err = e.storeDocument(doc, data.Content)
+	if err != nil && !errors.Is(err, ErrDuplicate) {
+		return "", err
+	}
+	// the snapshot of a stored page is refreshed
+	e.archivePage(ctx, doc.DocID, data, inline)
+	return doc.DocID, err
+}
+
+// pageFields returns the fields indexed for a web page stored under
+// identifier.
+func pageFields(identifier string, data *scraper.ScrapeData) map[search.Field]string {
+	return map[search.Field]string{
+		search.TitleField:       data.Title,
+		search.HeadingsField:    strings.Join(data.Headings, "\n"),
+		search.URLField:         scraper.URLWords(identifier),
+		search.DescriptionField: data.Description,
+		search.BodyField:        data.Body,
+	}
+}
+
+// archivePage keeps the raw HTML of a scraped page, so that it can still be
+// read once it disappears from the web. If inline is true, a single-file view
+// embedding the page resources is kept too. Failures are only logged, the
+// document itself is already stored.
+func (e *DocuEngine) archivePage(ctx context.Context, docID string, data *scraper.ScrapeData, inline bool) {
+	var inlined []byte
+	if inline {
+		var err error
+		inlined, err = scraper.ArchivePage(ctx, data.HTML, data.URL, true, e.scrapeOptions, e.log)
 		if err != nil {
-			log.Error(fmt.Sprintf("DocCounter recovery failed, documents may have been lost: %s", err))
-			return nil, err
+			e.log.Warning(fmt.Sprintf("error inlining the resources of %s: %s", data.URL, err))
 		}
-		log.Warning("DocCounter succesfully recovered")
 	}
+	err := InsertSnapshot(e.db, docID, data.URL, data.HTML, inlined, time.Now().Unix())
+	if err != nil {
+		e.log.Warning(fmt.Sprintf("error archiving %s: %s", data.URL, err))
+	}
+}
 
-	if docCounter.Ts != latestTs {
-		log.Warning("DocCounter is out of sync with latest changes, recovering")
-		docCounter, err = recoverDocCounter(dataFolder, db)
+// SnapshotFile writes the archived page of a document to the cache folder
+// and returns the path of the file.
+func (e *DocuEngine) SnapshotFile(docID string) (string, error) {
+	view, err := e.snapshotView(docID)
+	if err != nil {
+		return "", err
+	}
+	snapshotFolder := filepath.Join(xdg.CacheHome, "DocuStore", "snapshots")
+	err = os.MkdirAll(snapshotFolder, 0755)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(snapshotFolder, docID+".html")
+	err = os.WriteFile(path, view, 0644)
+	return path, err
+}
+
+// snapshotView returns the archived page of a document as it is opened: its
+// single-file view if it has one, its raw HTML made to render from disk
+// otherwise.
+func (e *DocuEngine) snapshotView(docID string) ([]byte, error) {
+	html, pageURL, err := LoadSnapshot(e.db, docID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("no archived snapshot for this document")
+	}
+	if err != nil {
+		return nil, err
+	}
+	view, err := LoadInlinedSnapshot(e.db, docID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return scraper.ArchivePage(context.Background(), html, pageURL, false, e.scrapeOptions, e.log)
+	}
+	return view, err
+}
+
+// documentURL is the identifier of a scraped page: its canonical link if it
+// declares one, the normalized URL it was fetched from otherwise.
+func documentURL(url string, data *scraper.ScrapeData) (string, error) {
+	if data.Canonical != "" {
+		return data.Canonical, nil
+	}
+	return scraper.NormalizeURL(url)
+}
+
+// Crawl stores every page reachable from startURL as its own document, all
+// grouped under collection. It returns the number of new pages, also when ctx
+// is cancelled. Pages that were already stored are only added to collection.
+func (e *DocuEngine) Crawl(ctx context.Context, startURL string, opts scraper.CrawlOptions, collection string) (int, error) {
+	if collection == "" {
+		collection = startURL
+	}
+	opts.Scrape = e.scrapeOptions
+	added := 0
+	err := scraper.Crawl(ctx, startURL, opts, e.log, func(page *scraper.CrawledPage) error {
+		docID, err := e.addPage(ctx, page.URL, page.Data, e.archiveResources)
+		if err != nil && !errors.Is(err, ErrDuplicate) {
+			e.log.Warning(fmt.Sprintf("error adding %s: %s", page.URL, err))
+			return nil
+		}
+		if err == nil {
+			added++
+		}
+		return AddToCollection(e.db, collection, docID)
+	})
+	return added, err
+}
+
+// addDocument stores a document and returns its ID, along with ErrDuplicate
+// if it is already stored.
+func (e *DocuEngine) addDocument(text string, identifier string, title string, docType search.DocType) (string, error) {
+	if text == "" {
+		return "", ErrEmptyContent
+	}
+	doc := e.analyzer.NewDocSummary(text, identifier, title, docType)
+	err := e.storeDocument(doc, text)
+	if err != nil && !errors.Is(err, ErrDuplicate) {
+		return "", err
+	}
+	return doc.DocID, err
+}
+
+// storeDocument stores a document with the content shown to the user, which
+// may differ from the text it was indexed from. It returns ErrDuplicate if the
+// document is already stored.
+func (e *DocuEngine) storeDocument(docSummary *search.DocSummary, content string) error {
+	if docSummary.Title == "" {
+		return ErrEmptyTitle
+	}
+	if len(docSummary.TermFreqs) == 0 {
+		return ErrEmptyContent
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ts := time.Now().Unix()
+	err := e.checkNearDuplicates(docSummary)
+	if err != nil {
+		return err
+	}
+	rows, err := InsertDocument(e.db, docSummary, content, ts)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrDuplicate
+	}
+
+	err = e.index.InsertDoc(docSummary, ts)
+	if err != nil {
+		return err
+	}
+	err = e.embedDocument(docSummary.DocID, content)
+	if err != nil {
+		e.log.Warning(fmt.Sprintf("error computing the embedding of %s: %s", docSummary.Title, err))
+	}
+	return nil
+}
+
+// scheduleVectorSave saves the vector index once changes have stopped for
+// vectorSaveDelay, rather than writing the whole graph on every change. An
+// index left out of sync by a crash is rebuilt from the stored vectors.
+// e.mu must be locked.
+func (e *DocuEngine) scheduleVectorSave() {
+	e.vectorsChanged = true
+	if e.vectorsSave != nil {
+		e.vectorsSave.Reset(vectorSaveDelay)
+		return
+	}
+	e.vectorsSave = time.AfterFunc(vectorSaveDelay, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		err := e.saveVectors()
 		if err != nil {
-			log.Error(fmt.Sprintf("DocCounter recovery failed, documents may have been lost: %s", err))
-			return nil, err
+			e.log.Warning(fmt.Sprintf("error saving the vector index: %s", err))
 		}
-		log.Warning("DocCounter succesfully recovered")
+	})
+}
+
+// saveVectors writes the vector index if it changed. e.mu must be locked.
+func (e *DocuEngine) saveVectors() error {
+	if e.vectors == nil || !e.vectorsChanged {
+		return nil
 	}
+	err := SaveStruct(e.vectorsPath, e.vectors)
+	if err != nil {
+		return err
+	}
+	e.vectorsChanged = false
+	return nil
+}
 
-	return docCounter, nil
+// Close waits for background work and closes the database.
+func (e *DocuEngine) Close() error {
+	e.mu.RLock()
+	stop := e.stopEmbeddings
+	e.mu.RUnlock()
+	if stop != nil {
+		stop()
+	}
+	e.embeddings.Wait()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.vectorsSave != nil {
+		e.vectorsSave.Stop()
+	}
+	err := e.saveVectors()
+	if err != nil {
+		return err
+	}
+	err = e.index.Close()
+	if err != nil {
+		return err
+	}
+	return e.db.Close()
 }
 
-func recoverDocCounter(dataFolder string, db *sql.DB) (*search.DocCounter, error) {
-	docIDs, err := ListDocuments(db)
+// DocumentInfo describes a stored document.
+type DocumentInfo struct {
+	DocID      string
+	Title      string
+	Identifier string
+	Type       string
+	Timestamp  int64
+	Tags       []string
+}
+
+func (e *DocuEngine) DocumentInfo(docID string) (*DocumentInfo, error) {
+	doc, ts, err := LoadDocSummary(e.db, docID)
 	if err != nil {
 		return nil, err
 	}
+	tags, err := LoadTags(e.db, docID)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentInfo{
+		DocID:      docID,
+		Title:      doc.Title,
+		Identifier: doc.Identifier,
+		Type:       doc.Type.String(),
+		Timestamp:  ts,
+		Tags:       tags,
+	}, nil
+}
 
-	docCounter := search.NewDocCounter()
-	var doc *search.DocSummary
-	var ts int64
+// ListDocuments describes all stored documents, or only those with the given
+// tag if it is not empty, newest first.
+func (e *DocuEngine) ListDocuments(tag string) ([]*DocumentInfo, error) {
+	var docIDs []string
+	var err error
+	if tag == "" {
+		docIDs, err = ListDocuments(e.db)
+	} else {
+		docIDs, err = ListTaggedDocuments(e.db, tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*DocumentInfo, 0, len(docIDs))
 	for _, docID := range docIDs {
-		doc, ts, err = LoadDocSummary(db, docID)
+		info, err := e.DocumentInfo(docID)
 		if err != nil {
 			return nil, err
 		}
-		docCounter.AddDocument(doc, ts)
+		out = append(out, info)
 	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Timestamp > out[j].Timestamp
+	})
+	return out, nil
+}
 
-	dcPath := filepath.Join(dataFolder, "docCounter.gob")
-	err = SaveStruct(dcPath, docCounter)
+// Reindex rebuilds the inverted index from the documents stored in the
+// database, and returns the number of documents.
+func (e *DocuEngine) Reindex() (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := recoverIndex(e.index, e.db, e.boosts)
+	if err != nil {
+		return 0, err
+	}
+	return e.index.NumDocs(), nil
+}
+
+// Stats describes the open library.
+type Stats struct {
+	Library        string
+	DataFolder     string
+	Documents      int
+	Types          map[string]int // number of documents of each type
+	Terms          int            // distinct terms in the index
+	Tags           int
+	WatchedFolders int
+	EmbeddingModel string // empty unless embeddings are enabled
+	SearchMode     string
+	DiskSize       int64 // bytes used by the library
+}
+
+func (e *DocuEngine) Stats() (*Stats, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	docIDs, err := ListDocuments(e.db)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{
+		Library:    e.library,
+		DataFolder: e.dataFolder,
+		Documents:  len(docIDs),
+		Types:      make(map[string]int),
+		SearchMode: e.searchMode,
+	}
+	for _, doc := range e.index.Summaries(docIDs...) {
+		stats.Types[doc.Type.String()]++
+	}
+	for _, count := range e.docCounter.DocCounts {
+		if count > 0 {
+			stats.Terms++
+		}
+	}
+	if e.embedder != nil {
+		stats.EmbeddingModel = e.embedder.Name()
+	}
+	if stats.SearchMode == "" {
+		stats.SearchMode = LexicalSearch
+	}
+	stats.Tags, err = CountTags(e.db)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := ListWatchedFolders(e.db)
 	if err != nil {
 		return nil, err
 	}
-	return docCounter, nil
+	stats.WatchedFolders = len(folders)
+	// the default library holds the folders of the others
+	others := filepath.Join(e.dataFolder, librariesFolder)
+	err = filepath.WalkDir(e.dataFolder, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && path == others {
+			return filepath.SkipDir
+		}
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			stats.DiskSize += info.Size()
+		}
+		return nil
+	})
+	return stats, err
 }
 
-func (e *DocuEngine) addFile(filePath string) error {
-	content, err := os.ReadFile(filePath)
+// DeleteDocument removes a document from the collection and the index.
+func (e *DocuEngine) DeleteDocument(docID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	doc, _, err := LoadDocSummary(e.db, docID)
+	if err != nil {
+		return err
+	}
+	err = DeleteDocument(e.db, docID)
+	if err != nil {
+		return err
+	}
+	ts, err := GetLatestTimestamp(e.db)
+	if err != nil {
+		return err
+	}
+	err = e.index.RemoveDoc(doc, ts)
 	if err != nil {
 		return err
 	}
-	text := string(content)
-	e.addDocument(text, text, filePath, search.DocType(search.Text))
+	if e.vectors != nil {
+		e.vectors.Delete(docID)
+		e.scheduleVectorSave()
+	}
 	return nil
 }
 
-func (e *DocuEngine) AddText(text string, title string) error {
-	err := e.addDocument(text, text, title, search.DocType(search.Text))
-	return err
-
-}
-
-func (e *DocuEngine) AddURL(url string) error {
-	data, err := scraper.ScrapeText(url, e.log)
+// TagDocument adds tags to an existing document.
+func (e *DocuEngine) TagDocument(docID string, tags ...string) error {
+	_, _, err := LoadDocSummary(e.db, docID)
 	if err != nil {
 		return err
 	}
-	err = e.addDocument(data.Content, url, data.Title, search.DocType(search.URL))
-	return err
+	return AddTags(e.db, docID, cleanTags(tags)...)
 }
 
-func (e *DocuEngine) addDocument(text string, identifier string, title string, docType search.DocType) error {
-	if title == "" {
-		return errors.New("empty title is not allowed")
+// UntagDocument removes tags from a document.
+func (e *DocuEngine) UntagDocument(docID string, tags ...string) error {
+	return RemoveTags(e.db, docID, cleanTags(tags)...)
+}
+
+func cleanTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			out = append(out, tag)
+		}
 	}
-	if text == "" {
-		return errors.New("empty content")
+	return out
+}
+
+// checkNearDuplicates warns about, or refuses, a document whose fingerprint
+// is close to one already stored. The closest one is reported, the first by
+// ID on ties.
+func (e *DocuEngine) checkNearDuplicates(doc *search.DocSummary) error {
+	if len(doc.TermFreqs) == 0 {
+		return nil
 	}
-	ts := time.Now().Unix()
-	docSummary := search.NewDocSummary(text, identifier, title, docType)
-	rows, err := InsertDocument(e.db, docSummary, text, ts)
+	docIDs, fingerprints, err := LoadNearFingerprints(e.db, doc.Fingerprint)
 	if err != nil {
 		return err
 	}
-	if rows == 0 {
-		e.log.Info("Document is already in the collection")
+	closest, closestDistance := "", search.NearDuplicateDistance+1
+	for i, docID := range docIDs {
+		distance := search.HammingDistance(doc.Fingerprint, fingerprints[i])
+		if docID != doc.DocID && distance < closestDistance {
+			closest, closestDistance = docID, distance
+		}
+	}
+	if closest == "" {
 		return nil
 	}
-
-	e.index.InsertDoc(docSummary, ts)
-	e.docCounter.AddDocument(docSummary, ts)
-
-	err = SaveStruct(
-		filepath.Join(e.dataFolder, "index.gob"),
-		e.index,
-	)
+	existing, _, err := LoadDocSummary(e.db, closest)
 	if err != nil {
 		return err
 	}
-
-	err = SaveStruct(
-		filepath.Join(e.dataFolder, "docCounter.gob"),
-		e.docCounter,
-	)
-	return err
+	if e.refuseNearDuplicates {
+		return fmt.Errorf("%w: %s", ErrNearDuplicate, existing.Title)
+	}
+	e.log.Warning(fmt.Sprintf("%s is a near-duplicate of %s", doc.Title, existing.Title))
+	return nil
 }
 
-func (e *DocuEngine) QueryDocument(text string) ([]*search.SearchResult, error) {
-	tokens := search.Tokenize(text)
-	e.log.Debug(fmt.Sprintf("searching with tokens: %v", tokens))
-	docIDs := e.index.SearchTokens(tokens)
-	docSummaries, err := LoadDocSummaries(context.Background(), e.db, docIDs...)
+// Duplicates lists clusters of documents with near-identical content. The
+// score of each document is its similarity to the first one in the cluster.
+func (e *DocuEngine) Duplicates(ctx context.Context) ([][]*search.SearchResult, error) {
+	fingerprints, err := LoadFingerprints(e.db)
 	if err != nil {
 		return nil, err
 	}
-
-	similarities := e.searcher.Search(text, docSummaries...)
-	return similarities, nil
+	clusters := search.NearDuplicateClusters(fingerprints, search.NearDuplicateDistance)
+	out := make([][]*search.SearchResult, 0, len(clusters))
+	for _, cluster := range clusters {
+		docs, err := LoadDocSummaries(ctx, e.db, cluster...)
+		if err != nil {
+			return nil, err
+		}
+		first := fingerprints[cluster[0]]
+		results := make([]*search.SearchResult, len(docs))
+		for i, doc := range docs {
+			distance := search.HammingDistance(first, fingerprints[cluster[i]])
+			results[i] = &search.SearchResult{
+				DocID:      cluster[i],
+				Title:      doc.Title,
+				Identifier: doc.Identifier,
+				Type:       doc.Type.String(),
+				Score:      1 - float64(distance)/64,
+			}
+		}
+		out = append(out, results)
+	}
+	return out, nil
 }
 
-func (e *DocuEngine) LoadText(docID string) (string, error) {
-	return LoadText(e.db, docID)
+// default maximum number of documents returned by a query
+const maxResults = 100
+
+// QueryDocument ranks documents by their similarity to text. With
+// embeddings enabled, the lexical ranking is fused with the semantic one,
+// depending on the search mode. A search superseded by another one should be
+// cancelled through ctx.
+func (e *DocuEngine) QueryDocument(ctx context.Context, text string) ([]*search.SearchResult, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	// the search may have been superseded while waiting for a change
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var similarities []*search.SearchResult
+	var err error
+	if e.searchMode != SemanticSearch {
+		termFreqs := e.analyzer.TermFrequencies(text)
+		e.log.Debug(fmt.Sprintf("searching with tokens: %v", termFreqs))
+		similarities, err = e.index.Search(ctx, termFreqs, e.maxResults)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e.embedder == nil || e.searchMode == LexicalSearch {
+		return similarities, nil
+	}
+
+	semanticResults, err := e.semanticSearch(ctx, text, semanticCandidates)
+	if err != nil {
+		return nil, err
+	}
+	if e.searchMode == SemanticSearch {
+		return semanticResults, nil
+	}
+	return search.FuseRRF(similarities, semanticResults), nil
 }
 
-func printSearchResults(sims []*search.SearchResult) {
-	fmt.Println("Here are the top 5 matches:")
-	for i, sim := range sims {
-		if sim.Score == 0.0 {
-			break
-		}
-		if i == 5 {
+// number of distinctive terms of a document used to find similar ones
+const similarTerms = 25
+
+// SimilarTo returns up to k documents similar to a stored one, ranked by
+// their similarity to its most distinctive terms.
+func (e *DocuEngine) SimilarTo(ctx context.Context, docID string, k int) ([]*search.SearchResult, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("invalid number of similar documents: %d", k)
+	}
+	doc, _, err := loadDocSummary(ctx, e.db, docID)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	terms := e.searcher.TopTerms(doc, similarTerms)
+	results, err := e.index.Search(ctx, terms, k+1)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if result.DocID == docID {
+			results = append(results[:i], results[i+1:]...)
 			break
 		}
-		fmt.Printf("Match: %d | Score: %.2f\n", i+1, sim.Score)
-		fmt.Println(sim.Title)
-		if sim.Type == search.URL.String() {
-			fmt.Println(sim.Identifier)
-		}
-		fmt.Println("--------------------------------------------")
 	}
+	return results[:min(k, len(results))], nil
+}
+
+func (e *DocuEngine) LoadText(docID string) (string, error) {
+	return LoadText(e.db, docID)
 }
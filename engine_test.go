@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"DocuStore/scraper"
+	"DocuStore/search"
+)
+
+func openTestEngine(t *testing.T) *DocuEngine {
+	t.Helper()
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+// writeWordVectors writes a model with a random vector for each word.
+func writeWordVectors(t *testing.T, rng *rand.Rand, words []string) string {
+	var model strings.Builder
+	fmt.Fprintf(&model, "%d 8\n", len(words))
+	for _, word := range words {
+		model.WriteString(word)
+		for i := 0; i < 8; i++ {
+			fmt.Fprintf(&model, " %.3f", rng.Float64()-0.5)
+		}
+		model.WriteString("\n")
+	}
+	path := filepath.Join(t.TempDir(), "vectors.vec")
+	err := os.WriteFile(path, []byte(model.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestConcurrentAddSearch adds and deletes documents while searching, and is
+// meant to run with the race detector.
+func TestConcurrentAddSearch(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	words := loadWords(t)
+	engine := openTestEngine(t)
+	err := engine.EnableEmbeddings(writeWordVectors(t, rng, words[:200]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	first, err := engine.AddText("shared first note", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, docsPerWriter = 4, 10
+	texts := make([][]string, writers)
+	for w := range texts {
+		for i := 0; i < docsPerWriter; i++ {
+			texts[w] = append(texts[w], fmt.Sprintf("shared writer%d note%d %s", w, i, randomQuery(rng, words, 30)))
+		}
+	}
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, text := range texts[w] {
+				docID, err := engine.AddText(text, fmt.Sprintf("note %d of writer %d", i, w))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// every other note is deleted right away
+				if i%2 == 1 {
+					err = engine.DeleteDocument(docID)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	var searches sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		searches.Add(1)
+		go func() {
+			defer searches.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				results, err := engine.QueryDocument(ctx, "shared note "+words[r])
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				seen := make(map[string]bool)
+				for _, result := range results {
+					if seen[result.DocID] || math.IsNaN(result.Score) {
+						t.Errorf("inconsistent result %+v", result)
+					}
+					seen[result.DocID] = true
+				}
+				_, err = engine.SimilarTo(ctx, first, 5)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	searches.Wait()
+
+	err = engine.SetSearchMode(LexicalSearch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := engine.QueryDocument(ctx, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 1 + writers*docsPerWriter/2; len(results) != expected {
+		t.Errorf("%d documents found, expected %d", len(results), expected)
+	}
+}
+
+func TestEmbedExistingDocuments(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	words := loadWords(t)
+	engine := openTestEngine(t)
+	for i := 0; i < 20; i++ {
+		_, err := engine.AddText(randomQuery(rng, words, 20), fmt.Sprintf("note %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	modelPath := writeWordVectors(t, rng, words[:1000])
+	err := engine.EnableEmbeddings(modelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.embeddings.Wait()
+	model := engine.embedder
+	missing, err := ListUnembeddedDocuments(engine.db, model.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 || engine.vectors.Len() != 20 {
+		t.Errorf("%d documents without a vector, %d in the index", len(missing), engine.vectors.Len())
+	}
+	if _, err = os.Stat(filepath.Join(engine.dataFolder, "hnsw-"+model.ID()+".gob")); err != nil {
+		t.Error(err)
+	}
+
+	// a renamed model keeps its vectors
+	renamed := filepath.Join(t.TempDir(), "renamed.vec")
+	err = os.Rename(modelPath, renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.EnableEmbeddings(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if engine.embedder.ID() != model.ID() {
+		t.Errorf("model identified as %s, then %s", model.ID(), engine.embedder.ID())
+	}
+	if engine.vectors.Len() != 20 {
+		t.Errorf("%d documents in the index of the renamed model", engine.vectors.Len())
+	}
+}
+
+func TestVectorIndexSave(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	words := loadWords(t)
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.EnableEmbeddings(writeWordVectors(t, rng, words[:1000]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedLen := func() int {
+		index := NewHNSWIndex(DefaultHNSWParams)
+		err := LoadStruct(engine.vectorsPath, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index.Len()
+	}
+	var docIDs []string
+	for i := 0; i < 10; i++ {
+		docID, err := engine.AddText(randomQuery(rng, words, 20), fmt.Sprintf("note %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		docIDs = append(docIDs, docID)
+	}
+	err = engine.DeleteDocument(docIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// saved later, not on every change
+	if n := savedLen(); n != 0 {
+		t.Errorf("%d vectors saved right after adding documents", n)
+	}
+	err = engine.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := savedLen(); n != 9 {
+		t.Errorf("%d vectors saved on close, expected 9", n)
+	}
+}
+
+func TestVectorIndexParams(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	words := loadWords(t)
+	modelPath := writeWordVectors(t, rng, words[:1000])
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	open := func(params HNSWParams) *DocuEngine {
+		config.Search.HNSW = params
+		engine, err := NewEngine(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = engine.EnableEmbeddings(modelPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return engine
+	}
+	engine := open(DefaultHNSWParams)
+	for i := 0; i < 10; i++ {
+		_, err := engine.AddText(randomQuery(rng, words, 20), fmt.Sprintf("note %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, params := range []HNSWParams{
+		{M: 16, EfConstruction: 200, EfSearch: 32},
+		{M: 8, EfConstruction: 100, EfSearch: 32},
+	} {
+		err := engine.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine = open(params)
+		if engine.vectors.(*HNSWIndex).Params != params {
+			t.Errorf("loaded index has params %+v, expected %+v", engine.vectors.(*HNSWIndex).Params, params)
+		}
+		if n := engine.vectors.Len(); n != 10 {
+			t.Errorf("loaded index has %d vectors, expected 10", n)
+		}
+	}
+	err := engine.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCancelledSearch(t *testing.T) {
+	engine := openTestEngine(t)
+	_, err := engine.AddText("a note to search", "note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = engine.QueryDocument(ctx, "note")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled search returned %v", err)
+	}
+}
+
+func TestEngineErrors(t *testing.T) {
+	engine := openTestEngine(t)
+	ctx := context.Background()
+	docID, err := engine.AddText("a note stored twice", "note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := engine.AddText("a note stored twice", "note")
+	if !errors.Is(err, ErrDuplicate) || again != docID {
+		t.Errorf("adding a note again returned %q, %v", again, err)
+	}
+	if exitCode(err) != exitDuplicate {
+		t.Errorf("exit code %d for a duplicate", exitCode(err))
+	}
+	if _, err = engine.AddText("   ", "empty"); !errors.Is(err, ErrEmptyContent) {
+		t.Errorf("adding an empty note returned %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	err = os.WriteFile(path, []byte("a text file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		fileID, err := engine.addFile(path)
+		if err != nil && !errors.Is(err, ErrDuplicate) {
+			t.Fatal(err)
+		}
+		if _, err = engine.DocumentInfo(fileID); err != nil {
+			t.Errorf("the ID of an added file is not stored: %v", err)
+		}
+	}
+
+	err = engine.DeleteDocument("missing")
+	if !errors.Is(err, ErrNotFound) || exitCode(err) != exitNotFound {
+		t.Errorf("deleting a missing document returned %v", err)
+	}
+	if _, err = engine.SimilarTo(ctx, "missing", 5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("similar documents of a missing document returned %v", err)
+	}
+	for _, k := range []int{0, -1} {
+		if results, err := engine.SimilarTo(ctx, docID, k); err == nil {
+			t.Errorf("%d similar documents returned %v", k, results)
+		}
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	_, err = engine.AddURL(ctx, server.URL+"/missing")
+	var fetchErr *scraper.FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusNotFound {
+		t.Errorf("adding a missing page returned %v", err)
+	}
+	if exitCode(err) != exitFetchFailed {
+		t.Errorf("exit code %d for a missing page", exitCode(err))
+	}
+
+	path = filepath.Join(t.TempDir(), "corrupted.gob")
+	err = os.WriteFile(path, []byte("not gob"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = LoadStruct(path, NewInvertedIndex())
+	if !errors.Is(err, ErrCorrupted) || exitCode(err) != exitCorrupted {
+		t.Errorf("loading a corrupted file returned %v", err)
+	}
+}
+
+func TestCrawlAgain(t *testing.T) {
+	engine := openTestEngine(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>page %s</title></head><body>text of %s <a href="/b">b</a></body></html>`, r.URL.Path, r.URL.Path)
+	}))
+	defer server.Close()
+
+	opts := scraper.CrawlOptions{MaxDepth: 1}
+	for i, expected := range []int{2, 0} {
+		added, err := engine.Crawl(context.Background(), server.URL+"/", opts, "site")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != expected {
+			t.Errorf("crawl %d added %d pages, expected %d", i+1, added, expected)
+		}
+	}
+	var count int
+	err := engine.db.QueryRow("SELECT COUNT(*) FROM collections WHERE name = ?", "site").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("%d documents in the collection, expected 2", count)
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	words := loadWords(t)
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	config.RefuseDuplicates = true
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+
+	text := randomQuery(rng, words, 300)
+	_, err = engine.AddText(text, "original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = engine.AddText(text+" addendum", "copy")
+	if !errors.Is(err, ErrNearDuplicate) || !strings.Contains(err.Error(), "original") {
+		t.Errorf("adding a near-duplicate returned %v", err)
+	}
+	_, err = engine.AddText(randomQuery(rng, words, 300), "other")
+	if err != nil {
+		t.Errorf("adding an unrelated document returned %v", err)
+	}
+
+	// documents without terms get no fingerprint to match each other
+	for _, title := range []string{"empty1", "empty2"} {
+		_, err = InsertDocument(engine.db, &search.DocSummary{DocID: title, Title: title}, "", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fingerprints, err := LoadFingerprints(engine.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fingerprints) != 2 {
+		t.Errorf("%d fingerprints stored, expected 2", len(fingerprints))
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	page := `<html><head><title>Archived page</title><script>track()</script><link rel="stylesheet" href="/site.css"></head>` +
+		`<body><p>text of the archived page</p></body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/site.css" {
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, "p { color: red }")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	for _, inline := range []bool{false, true} {
+		config := DefaultConfig()
+		config.DataDir = t.TempDir()
+		config.ArchiveResources = inline
+		engine, err := NewEngine(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close()
+		docID, err := engine.AddURL(context.Background(), server.URL+"/page")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		html, url, err := LoadSnapshot(engine.db, docID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(html) != page || url != server.URL+"/page" {
+			t.Errorf("inline %v: snapshot of %s is not the raw page: %s", inline, url, html)
+		}
+		view, err := engine.snapshotView(docID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(view), "track()") || !strings.Contains(string(view), "text of the archived page") {
+			t.Errorf("inline %v: view %s", inline, view)
+		}
+		if inlined := strings.Contains(string(view), "<style>p { color: red }</style>"); inlined != inline {
+			t.Errorf("inline %v: stylesheet inlined %v in %s", inline, inlined, view)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "errors"
+
+// Errors returned by the engine, possibly wrapped with details. The app shows
+// their messages to the user, and the command line interface maps them to
+// exit codes.
+var (
+	// ErrDuplicate is returned along with the ID of a document that is
+	// already in the collection.
+	ErrDuplicate = errors.New("the document is already in the collection")
+	// ErrNearDuplicate is returned when refusing a document whose content is
+	// nearly identical to a document already in the collection.
+	ErrNearDuplicate = errors.New("a near-duplicate document is already in the collection")
+	ErrEmptyContent  = errors.New("empty content")
+	ErrEmptyTitle    = errors.New("empty title is not allowed")
+	ErrNotFound      = errors.New("document not found")
+	// ErrNoLibrary is returned when opening a library that was not created.
+	ErrNoLibrary = errors.New("library not found")
+	// ErrCorrupted is returned when stored data cannot be read back.
+	ErrCorrupted = errors.New("storage is corrupted")
+)
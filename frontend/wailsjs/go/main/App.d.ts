@@ -2,10 +2,34 @@
 // This file is automatically generated. DO NOT EDIT
 import {search} from '../models';
 
+export function AddHTML(arg1:string,arg2:string):Promise<void>;
+
 export function AddText(arg1:string,arg2:string):Promise<void>;
 
 export function AddURL(arg1:string):Promise<void>;
 
-export function ReadTextFile(arg1:string):Promise<string>;
+export function AddWatchedFolder(arg1:string):Promise<void>;
+
+export function CreateLibrary(arg1:string):Promise<void>;
+
+export function CurrentLibrary():Promise<string>;
+
+export function Duplicates():Promise<Array<Array<search.SearchResult>>>;
+
+export function ListLibraries():Promise<Array<string>>;
+
+export function ListWatchedFolders():Promise<Array<string>>;
+
+export function OpenSnapshot(arg1:string):Promise<void>;
+
+export function ReadTextFile(arg1:string,arg2:string):Promise<string>;
+
+export function RemoveWatchedFolder(arg1:string):Promise<void>;
 
 export function Search(arg1:string):Promise<Array<search.SearchResult>>;
+
+export function SearchAllLibraries(arg1:string):Promise<Array<search.SearchResult>>;
+
+export function SimilarTo(arg1:string,arg2:number):Promise<Array<search.SearchResult>>;
+
+export function SwitchLibrary(arg1:string):Promise<void>;
@@ -2,6 +2,10 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddHTML(arg1, arg2) {
+  return window['go']['main']['App']['AddHTML'](arg1, arg2);
+}
+
 export function AddText(arg1, arg2) {
   return window['go']['main']['App']['AddText'](arg1, arg2);
 }
@@ -10,10 +14,54 @@ export function AddURL(arg1) {
   return window['go']['main']['App']['AddURL'](arg1);
 }
 
-export function ReadTextFile(arg1) {
-  return window['go']['main']['App']['ReadTextFile'](arg1);
+export function AddWatchedFolder(arg1) {
+  return window['go']['main']['App']['AddWatchedFolder'](arg1);
+}
+
+export function CreateLibrary(arg1) {
+  return window['go']['main']['App']['CreateLibrary'](arg1);
+}
+
+export function CurrentLibrary() {
+  return window['go']['main']['App']['CurrentLibrary']();
+}
+
+export function Duplicates() {
+  return window['go']['main']['App']['Duplicates']();
+}
+
+export function ListLibraries() {
+  return window['go']['main']['App']['ListLibraries']();
+}
+
+export function ListWatchedFolders() {
+  return window['go']['main']['App']['ListWatchedFolders']();
+}
+
+export function OpenSnapshot(arg1) {
+  return window['go']['main']['App']['OpenSnapshot'](arg1);
+}
+
+export function ReadTextFile(arg1, arg2) {
+  return window['go']['main']['App']['ReadTextFile'](arg1, arg2);
+}
+
+export function RemoveWatchedFolder(arg1) {
+  return window['go']['main']['App']['RemoveWatchedFolder'](arg1);
 }
 
 export function Search(arg1) {
   return window['go']['main']['App']['Search'](arg1);
 }
+
+export function SearchAllLibraries(arg1) {
+  return window['go']['main']['App']['SearchAllLibraries'](arg1);
+}
+
+export function SimilarTo(arg1, arg2) {
+  return window['go']['main']['App']['SimilarTo'](arg1, arg2);
+}
+
+export function SwitchLibrary(arg1) {
+  return window['go']['main']['App']['SwitchLibrary'](arg1);
+}
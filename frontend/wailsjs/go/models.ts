@@ -6,6 +6,7 @@ export namespace search {
 	    Identifier: string;
 	    Type: string;
 	    Score: number;
+	    Library: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new SearchResult(source);
@@ -18,6 +19,7 @@ export namespace search {
 	        this.Identifier = source["Identifier"];
 	        this.Type = source["Type"];
 	        this.Score = source["Score"];
+	        this.Library = source["Library"];
 	    }
 	}
 
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+
+	"DocuStore/semantic"
+)
+
+// HNSWParams tune the recall, speed and memory use of an HNSW index.
+type HNSWParams struct {
+	// maximum number of links of a node above the bottom layer, which has
+	// twice as many. More links improve recall at the cost of memory.
+	M int `toml:"m"`
+	// number of candidates considered when inserting. Higher values build a
+	// better graph, more slowly.
+	EfConstruction int `toml:"ef_construction"`
+	// number of candidates considered when searching. Higher values improve
+	// recall, more slowly.
+	EfSearch int `toml:"ef_search"`
+}
+
+var DefaultHNSWParams = HNSWParams{M: 16, EfConstruction: 200, EfSearch: 64}
+
+// HNSWIndex is a Hierarchical Navigable Small World graph, an approximate
+// nearest neighbor index (Malkov and Yashunin, 2016). Deleted nodes are kept
+// to navigate the graph, and dropped when rebuilding it once they are a
+// quarter of the nodes.
+type HNSWIndex struct {
+	Params   HNSWParams
+	Nodes    []*hnswNode
+	IDs      map[string]int32 // node of each document
+	Entry    int32            // -1 if the graph is empty
+	MaxLevel int
+	Deleted  int
+
+	rng *rand.Rand
+	// visited[node] == visit for the nodes seen by the current search
+	visited []uint32
+	visit   uint32
+}
+
+type hnswNode struct {
+	DocID   string
+	Vector  []float32
+	Links   [][]int32 // neighbors on each layer, from the bottom one
+	Deleted bool
+}
+
+func NewHNSWIndex(params HNSWParams) *HNSWIndex {
+	return &HNSWIndex{
+		Params: params,
+		IDs:    make(map[string]int32),
+		Entry:  -1,
+	}
+}
+
+func (h *HNSWIndex) Len() int {
+	return len(h.IDs)
+}
+
+func (h *HNSWIndex) Vector(docID string) []float32 {
+	node, ok := h.IDs[docID]
+	if !ok {
+		return nil
+	}
+	return h.Nodes[node].Vector
+}
+
+// Insert adds a document to the index, replacing its previous vector.
+func (h *HNSWIndex) Insert(docID string, vector []float32) {
+	if _, ok := h.IDs[docID]; ok {
+		h.Delete(docID)
+	}
+	level := h.randomLevel()
+	id := int32(len(h.Nodes))
+	node := &hnswNode{DocID: docID, Vector: vector, Links: make([][]int32, level+1)}
+	h.Nodes = append(h.Nodes, node)
+	h.IDs[docID] = id
+	if h.Entry < 0 {
+		h.Entry = id
+		h.MaxLevel = level
+		return
+	}
+
+	entry := h.Entry
+	for layer := h.MaxLevel; layer > level; layer-- {
+		entry = h.searchLayer(vector, []int32{entry}, 1, layer)[0].node
+	}
+	entries := []int32{entry}
+	for layer := min(level, h.MaxLevel); layer >= 0; layer-- {
+		candidates := h.searchLayer(vector, entries, h.Params.EfConstruction, layer)
+		node.Links[layer] = h.selectNeighbors(candidates, h.maxLinks(layer))
+		for _, neighbor := range node.Links[layer] {
+			h.link(neighbor, id, layer)
+		}
+		entries = entries[:0]
+		for _, c := range candidates {
+			entries = append(entries, c.node)
+		}
+	}
+	if level > h.MaxLevel {
+		h.Entry = id
+		h.MaxLevel = level
+	}
+}
+
+// Delete removes a document from the results of the index.
+func (h *HNSWIndex) Delete(docID string) {
+	id, ok := h.IDs[docID]
+	if !ok {
+		return
+	}
+	delete(h.IDs, docID)
+	h.Nodes[id].Deleted = true
+	h.Deleted++
+	if h.Deleted > 16 && h.Deleted > len(h.Nodes)/4 {
+		h.rebuild()
+	}
+}
+
+// Search returns up to k neighbors of query, most similar first.
+func (h *HNSWIndex) Search(query []float32, k int) []Neighbor {
+	if h.Entry < 0 || k <= 0 {
+		return nil
+	}
+	entry := h.Entry
+	for layer := h.MaxLevel; layer > 0; layer-- {
+		entry = h.searchLayer(query, []int32{entry}, 1, layer)[0].node
+	}
+	// deleted nodes are filtered out afterwards, look a bit further
+	ef := max(h.Params.EfSearch, k) + min(h.Deleted, k)
+	neighbors := make([]Neighbor, 0, k)
+	for _, c := range h.searchLayer(query, []int32{entry}, ef, 0) {
+		if h.Nodes[c.node].Deleted {
+			continue
+		}
+		neighbors = append(neighbors, Neighbor{DocID: h.Nodes[c.node].DocID, Similarity: c.similarity})
+		if len(neighbors) == k {
+			break
+		}
+	}
+	return neighbors
+}
+
+// rebuild inserts the documents again in a new graph, dropping deleted nodes.
+func (h *HNSWIndex) rebuild() {
+	nodes := h.Nodes
+	*h = *NewHNSWIndex(h.Params)
+	for _, node := range nodes {
+		if !node.Deleted {
+			h.Insert(node.DocID, node.Vector)
+		}
+	}
+}
+
+func (h *HNSWIndex) maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * h.Params.M
+	}
+	return h.Params.M
+}
+
+func (h *HNSWIndex) randomLevel() int {
+	if h.rng == nil {
+		h.rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	levelFactor := 1 / math.Log(float64(max(h.Params.M, 2)))
+	return int(-math.Log(1-h.rng.Float64()) * levelFactor)
+}
+
+// link adds a link from node to target, pruning the links of node if it has
+// too many.
+func (h *HNSWIndex) link(node int32, target int32, layer int) {
+	links := append(h.Nodes[node].Links[layer], target)
+	if len(links) > h.maxLinks(layer) {
+		vector := h.Nodes[node].Vector
+		candidates := make([]hnswCandidate, len(links))
+		for i, link := range links {
+			candidates[i] = hnswCandidate{link, semantic.Similarity(vector, h.Nodes[link].Vector)}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].similarity > candidates[j].similarity
+		})
+		links = h.selectNeighbors(candidates, h.maxLinks(layer))
+	}
+	h.Nodes[node].Links[layer] = links
+}
+
+// selectNeighbors picks up to m links among candidates, sorted by decreasing
+// similarity. A candidate is preferred if it is closer to the new node than
+// to the neighbors already picked, which keeps links in every direction.
+func (h *HNSWIndex) selectNeighbors(candidates []hnswCandidate, m int) []int32 {
+	selected := make([]int32, 0, m)
+	var pruned []int32
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if semantic.Similarity(h.Nodes[c.node].Vector, h.Nodes[s].Vector) > c.similarity {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c.node)
+		} else {
+			pruned = append(pruned, c.node)
+		}
+	}
+	for _, node := range pruned {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, node)
+	}
+	return selected
+}
+
+// searchLayer returns the ef nodes of a layer most similar to query, found
+// by a best-first search from entries, most similar first.
+func (h *HNSWIndex) searchLayer(query []float32, entries []int32, ef int, layer int) []hnswCandidate {
+	h.startVisit()
+	candidates := candidateHeap{}       // most similar on top
+	results := candidateHeap{min: true} // least similar on top
+	for _, entry := range entries {
+		if h.visited[entry] == h.visit {
+			continue
+		}
+		h.visited[entry] = h.visit
+		c := hnswCandidate{entry, semantic.Similarity(query, h.Nodes[entry].Vector)}
+		candidates.push(c)
+		results.push(c)
+	}
+	for len(results.items) > ef {
+		results.pop()
+	}
+
+	for len(candidates.items) > 0 {
+		c := candidates.pop()
+		if len(results.items) >= ef && c.similarity < results.items[0].similarity {
+			break
+		}
+		for _, link := range h.Nodes[c.node].Links[layer] {
+			if h.visited[link] == h.visit {
+				continue
+			}
+			h.visited[link] = h.visit
+			similarity := semantic.Similarity(query, h.Nodes[link].Vector)
+			if len(results.items) < ef || similarity > results.items[0].similarity {
+				candidates.push(hnswCandidate{link, similarity})
+				results.push(hnswCandidate{link, similarity})
+				if len(results.items) > ef {
+					results.pop()
+				}
+			}
+		}
+	}
+
+	found := results.items
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].similarity > found[j].similarity
+	})
+	return found
+}
+
+// startVisit forgets the nodes visited by the previous search.
+func (h *HNSWIndex) startVisit() {
+	if len(h.visited) < len(h.Nodes) {
+		h.visited = append(h.visited, make([]uint32, len(h.Nodes)-len(h.visited))...)
+	}
+	h.visit++
+	if h.visit == 0 {
+		clear(h.visited)
+		h.visit = 1
+	}
+}
+
+type hnswCandidate struct {
+	node       int32
+	similarity float32
+}
+
+// candidateHeap is a binary heap of candidates by similarity, the most
+// similar on top unless min is set.
+type candidateHeap struct {
+	items []hnswCandidate
+	min   bool
+}
+
+func (c *candidateHeap) above(i, j int) bool {
+	if c.min {
+		return c.items[i].similarity < c.items[j].similarity
+	}
+	return c.items[i].similarity > c.items[j].similarity
+}
+
+func (c *candidateHeap) push(candidate hnswCandidate) {
+	c.items = append(c.items, candidate)
+	i := len(c.items) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !c.above(i, parent) {
+			break
+		}
+		c.items[i], c.items[parent] = c.items[parent], c.items[i]
+		i = parent
+	}
+}
+
+func (c *candidateHeap) pop() hnswCandidate {
+	top := c.items[0]
+	last := len(c.items) - 1
+	c.items[0] = c.items[last]
+	c.items = c.items[:last]
+	i := 0
+	for {
+		child := 2*i + 1
+		if child >= last {
+			break
+		}
+		if child+1 < last && c.above(child+1, child) {
+			child++
+		}
+		if !c.above(child, i) {
+			break
+		}
+		c.items[i], c.items[child] = c.items[child], c.items[i]
+		i = child
+	}
+	return top
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"DocuStore/semantic"
+)
+
+// flatIndex compares the query with every vector, giving the exact neighbors
+// approximated by HNSWIndex.
+type flatIndex struct {
+	vectors map[string][]float32
+}
+
+func newFlatIndex() *flatIndex {
+	return &flatIndex{vectors: make(map[string][]float32)}
+}
+
+func (f *flatIndex) Insert(docID string, vector []float32) {
+	f.vectors[docID] = vector
+}
+
+func (f *flatIndex) Delete(docID string) {
+	delete(f.vectors, docID)
+}
+
+func (f *flatIndex) Vector(docID string) []float32 {
+	return f.vectors[docID]
+}
+
+func (f *flatIndex) Len() int {
+	return len(f.vectors)
+}
+
+func (f *flatIndex) Search(query []float32, k int) []Neighbor {
+	neighbors := make([]Neighbor, 0, len(f.vectors))
+	for docID, vector := range f.vectors {
+		neighbors = append(neighbors, Neighbor{docID, semantic.Similarity(query, vector)})
+	}
+	sort.Slice(neighbors, func(i, j int) bool {
+		return neighbors[i].Similarity > neighbors[j].Similarity
+	})
+	return neighbors[:min(k, len(neighbors))]
+}
+
+func randomVector(rng *rand.Rand, dims int) []float32 {
+	vector := make([]float32, dims)
+	for i := range vector {
+		vector[i] = float32(rng.NormFloat64())
+	}
+	semantic.Normalize(vector)
+	return vector
+}
+
+// prepareVectors fills an HNSW index and an exact index with the same
+// random vectors.
+func prepareVectors(params HNSWParams, nDocs int, dims int) (*HNSWIndex, *flatIndex) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	index := NewHNSWIndex(params)
+	exact := newFlatIndex()
+	for i := 0; i < nDocs; i++ {
+		docID := fmt.Sprintf("doc %d", i)
+		vector := randomVector(rng, dims)
+		index.Insert(docID, vector)
+		exact.Insert(docID, vector)
+	}
+	return index, exact
+}
+
+// recall returns the fraction of the exact k nearest neighbors of the
+// queries found by index.
+func recall(index VectorIndex, exact VectorIndex, queries [][]float32, k int) float64 {
+	found := 0
+	for _, query := range queries {
+		expected := make(map[string]bool, k)
+		for _, neighbor := range exact.Search(query, k) {
+			expected[neighbor.DocID] = true
+		}
+		for _, neighbor := range index.Search(query, k) {
+			if expected[neighbor.DocID] {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(k*len(queries))
+}
+
+func TestHNSW(t *testing.T) {
+	index, exact := prepareVectors(DefaultHNSWParams, 2000, 32)
+	rng := rand.New(rand.NewPCG(3, 4))
+	queries := make([][]float32, 50)
+	for i := range queries {
+		queries[i] = randomVector(rng, 32)
+	}
+	if r := recall(index, exact, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 is %.2f", r)
+	}
+
+	for i := 0; i < 1000; i++ {
+		docID := fmt.Sprintf("doc %d", i)
+		index.Delete(docID)
+		exact.Delete(docID)
+	}
+	if index.Len() != 1000 || index.Vector("doc 0") != nil {
+		t.Errorf("%d documents left after deletion", index.Len())
+	}
+	if r := recall(index, exact, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 after deletion is %.2f", r)
+	}
+	for _, neighbor := range index.Search(queries[0], 1000) {
+		if exact.Vector(neighbor.DocID) == nil {
+			t.Fatalf("deleted document %s found", neighbor.DocID)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "hnsw.gob")
+	if err := SaveStruct(path, index); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewHNSWIndex(DefaultHNSWParams)
+	if err := LoadStruct(path, loaded); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Insert("new", queries[0])
+	if neighbors := loaded.Search(queries[0], 1); neighbors[0].DocID != "new" {
+		t.Errorf("inserted vector not found after loading, got %v", neighbors)
+	}
+}
+
+func BenchmarkHNSW(b *testing.B) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	for _, nDocs := range []int{1000, 10000} {
+		for _, dims := range []int{64, 300} {
+			queries := make([][]float32, 100)
+			for i := range queries {
+				queries[i] = randomVector(rng, dims)
+			}
+			b.Run(fmt.Sprintf("%d docs with %d dimensions", nDocs, dims), func(b *testing.B) {
+				start := time.Now()
+				index, exact := prepareVectors(DefaultHNSWParams, nDocs, dims)
+				build := time.Since(start)
+				for _, efSearch := range []int{16, 64, 256} {
+					index.Params.EfSearch = efSearch
+					b.Run(fmt.Sprintf("ef %d", efSearch), func(b *testing.B) {
+						for i := 0; i < b.N; i++ {
+							_ = index.Search(queries[i%len(queries)], 10)
+						}
+						b.StopTimer()
+						b.ReportMetric(recall(index, exact, queries, 10), "recall@10")
+						b.ReportMetric(float64(build.Milliseconds()), "build-ms")
+					})
+				}
+				b.Run("exact", func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						_ = exact.Search(queries[i%len(queries)], 10)
+					}
+				})
+			})
+		}
+	}
+}
@@ -1,52 +1,327 @@
 package main
 
-import "DocuStore/search"
+import (
+	"context"
+	"encoding/binary"
+	"math"
 
-type docToken struct {
-	docID string
-	token string
+	"DocuStore/search"
+)
+
+// Index maps tokens to the documents containing them, and ranks documents
+// for queries. Implementations must pass the conformance tests of
+// index_test.go.
+type Index interface {
+	// InsertDoc adds a document, replacing its previous version
+	InsertDoc(doc *search.DocSummary, timestamp int64) error
+	RemoveDoc(doc *search.DocSummary, timestamp int64) error
+	// Reset replaces the contents of the index with docs
+	Reset(docs *InvertedIndex, timestamp int64) error
+	// SearchTokens returns the documents containing any of the tokens, each
+	// once
+	SearchTokens(tokens []string) []string
+	// Search returns the k documents most similar to the query term
+	// frequencies, best first. It gives up once ctx is done.
+	Search(ctx context.Context, termFreqs map[string]float64, k int) ([]*search.SearchResult, error)
+	// Summaries returns the documents without their term frequencies
+	Summaries(docIDs ...string) []*search.DocSummary
+	// Counter counts the documents containing each token, and is kept up to
+	// date with the index
+	Counter() *search.DocCounter
+	NumDocs() int
+	// Timestamp returns the timestamp of the latest change
+	Timestamp() int64
+	// Close persists pending changes
+	Close() error
 }
 
-type HashmapIndex struct {
-	Map       map[string][]string
-	Timestamp int64 // timestamp of latest change
+// term frequencies are stored as fixed point numbers with this scale
+const freqScale = 1 << 16
+
+// InvertedIndex maps tokens to the documents containing them. Documents are
+// numbered densely in insertion order, so that posting lists hold small
+// integers instead of document IDs, stored as varint deltas.
+type InvertedIndex struct {
+	Docs      []indexedDoc            // document of each number
+	DocNums   map[string]uint32       // number of each document
+	Lists     map[string]*postingList // posting list of each token
+	Timestamp int64                   // timestamp of latest change
 }
 
-func (t *HashmapIndex) InsertDoc(doc *search.DocSummary, timestamp int64) {
+// indexedDoc keeps what is needed to rank a document and show it in the
+// results without loading its summary.
+type indexedDoc struct {
+	DocID      string // empty once removed
+	Title      string
+	Identifier string
+	Type       search.DocType
+	// inverse of the TF-IDF vector length of the document, 0 until weigh is
+	// called
+	InvNorm float32
+}
+
+// postingList holds the documents containing a token by increasing number,
+// each as the varint delta from the previous number (or from 0) followed by
+// the term frequency, weighted by the field boosts.
+type postingList struct {
+	Data []byte
+	Last uint32 // number of the last document, base of the next delta
+	Len  int
+	// highest normalized term frequency of the list, bounding its
+	// contribution to scores
+	MaxImpact float64
+}
+
+// Posting is a document containing a token.
+type Posting struct {
+	DocID string
+	Freq  float64
+}
+
+func NewInvertedIndex() *InvertedIndex {
+	return &InvertedIndex{
+		DocNums: make(map[string]uint32),
+		Lists:   make(map[string]*postingList),
+	}
+}
+
+// NumDocs returns the number of documents in the index.
+func (t *InvertedIndex) NumDocs() int {
+	return len(t.DocNums)
+}
+
+// InsertDoc adds a document to the posting lists of its tokens, weighing
+// its fields with boosts, and replacing its previous postings. Documents may
+// be inserted in any order, the timestamp of the index is the latest.
+func (t *InvertedIndex) InsertDoc(doc *search.DocSummary, boosts search.FieldBoosts, timestamp int64) {
+	if _, ok := t.DocNums[doc.DocID]; ok {
+		t.RemoveDoc(doc, timestamp)
+	}
+	num := uint32(len(t.Docs))
+	t.Docs = append(t.Docs, indexedDoc{
+		DocID:      doc.DocID,
+		Title:      doc.Title,
+		Identifier: doc.Identifier,
+		Type:       doc.Type,
+	})
+	t.DocNums[doc.DocID] = num
 	for token := range doc.TermFreqs {
-		docToken := &docToken{doc.DocID, token}
-		t.insert(docToken)
+		list, ok := t.Lists[token]
+		if !ok {
+			list = &postingList{}
+			t.Lists[token] = list
+		}
+		list.append(num, doc.WeightedFreq(token, boosts))
 	}
-	t.Timestamp = timestamp
+	t.Timestamp = max(t.Timestamp, timestamp)
 }
 
-func (t *HashmapIndex) insert(Data *docToken) {
-	if t.Map == nil {
-		t.Map = make(map[string][]string, 0)
-	} else {
-		val, ok := t.Map[Data.token]
-		if ok {
-			t.Map[Data.token] = append(val, Data.docID)
+// RemoveDoc removes a document from the posting lists of its tokens.
+func (t *InvertedIndex) RemoveDoc(doc *search.DocSummary, timestamp int64) {
+	num, ok := t.DocNums[doc.DocID]
+	if !ok {
+		return
+	}
+	for token := range doc.TermFreqs {
+		list, ok := t.Lists[token]
+		if !ok {
+			continue
+		}
+		kept := &postingList{MaxImpact: list.MaxImpact}
+		list.each(func(n uint32, freq uint32) {
+			if n != num {
+				kept.appendScaled(n, freq)
+			}
+		})
+		if kept.Len == 0 {
+			delete(t.Lists, token)
 		} else {
-			valArray := []string{Data.docID}
-			t.Map[Data.token] = valArray
+			t.Lists[token] = kept
 		}
 	}
+	delete(t.DocNums, doc.DocID)
+	t.Docs[num] = indexedDoc{}
+	t.Timestamp = timestamp
+	if len(t.Docs) > 16 && len(t.Docs) > 2*len(t.DocNums) {
+		t.compact()
+	}
 }
 
-func (t *HashmapIndex) SearchTokens(tokens []string) []string {
-	docMap := make(map[string]bool)
+// compact renumbers the documents densely, dropping the numbers of removed
+// ones.
+func (t *InvertedIndex) compact() {
+	renumbered := make([]uint32, len(t.Docs))
+	docs := make([]indexedDoc, 0, len(t.DocNums))
+	for num, doc := range t.Docs {
+		if doc.DocID != "" {
+			renumbered[num] = uint32(len(docs))
+			t.DocNums[doc.DocID] = uint32(len(docs))
+			docs = append(docs, doc)
+		}
+	}
+	for token, list := range t.Lists {
+		compacted := &postingList{MaxImpact: list.MaxImpact}
+		list.each(func(n uint32, freq uint32) {
+			compacted.appendScaled(renumbered[n], freq)
+		})
+		t.Lists[token] = compacted
+	}
+	t.Docs = docs
+}
+
+// weigh computes the norms of the documents and the impact bounds of the
+// posting lists, given the inverse document frequencies of tokens.
+func (t *InvertedIndex) weigh(idf func(token string) float64) {
+	norms := make([]float64, len(t.Docs))
+	for token, list := range t.Lists {
+		factor := idf(token)
+		list.each(func(n uint32, freq uint32) {
+			weight := float64(freq) / freqScale * factor
+			norms[n] += weight * weight
+		})
+	}
+	for num := range t.Docs {
+		t.Docs[num].InvNorm = 0
+		if norms[num] > 0 {
+			t.Docs[num].InvNorm = float32(1 / math.Sqrt(norms[num]))
+		}
+	}
+	for _, list := range t.Lists {
+		list.MaxImpact = 0
+		list.each(func(n uint32, freq uint32) {
+			list.MaxImpact = max(list.MaxImpact, t.impact(n, freq))
+		})
+	}
+}
+
+// impact is the term frequency of a posting divided by the norm of its
+// document.
+func (t *InvertedIndex) impact(num uint32, freq uint32) float64 {
+	return float64(freq) / freqScale * float64(t.Docs[num].InvNorm)
+}
+
+// SearchTokens returns the documents containing any of the tokens.
+func (t *InvertedIndex) SearchTokens(tokens []string) []string {
+	seen := make(map[uint32]bool)
 	out := make([]string, 0)
-	for i := 0; i < len(tokens); i++ {
-		docIDs, ok := t.Map[tokens[i]]
-		if ok {
-			for _, docID := range docIDs {
-				if _, val := docMap[docID]; !val {
-					docMap[docID] = true
-					out = append(out, docID)
-				}
-			}
+	for _, token := range tokens {
+		list, ok := t.Lists[token]
+		if !ok {
+			continue
 		}
+		list.each(func(n uint32, _ uint32) {
+			if !seen[n] {
+				seen[n] = true
+				out = append(out, t.Docs[n].DocID)
+			}
+		})
 	}
 	return out
 }
+
+// Postings returns the documents containing token with its frequency in
+// each, weighted by the field boosts, in insertion order.
+func (t *InvertedIndex) Postings(token string) []Posting {
+	list, ok := t.Lists[token]
+	if !ok {
+		return nil
+	}
+	out := make([]Posting, 0, list.Len)
+	list.each(func(n uint32, freq uint32) {
+		out = append(out, Posting{t.Docs[n].DocID, float64(freq) / freqScale})
+	})
+	return out
+}
+
+func (p *postingList) append(num uint32, freq float64) {
+	// round up so that rare tokens of long documents are not lost
+	scaled := uint32(min(math.Ceil(freq*freqScale), math.MaxUint32))
+	p.appendScaled(num, scaled)
+}
+
+func (p *postingList) appendScaled(num uint32, freq uint32) {
+	p.Data = binary.AppendUvarint(p.Data, uint64(num-p.Last))
+	p.Data = binary.AppendUvarint(p.Data, uint64(freq))
+	p.Last = num
+	p.Len++
+}
+
+// each calls fn with the number and scaled term frequency of every document
+// of the list, in increasing number.
+func (p *postingList) each(fn func(num uint32, freq uint32)) {
+	cursor := postingCursor{data: p.Data}
+	for cursor.next() {
+		fn(cursor.num, cursor.freq)
+	}
+}
+
+// postingCursor reads a posting list one document at a time.
+type postingCursor struct {
+	data []byte
+	num  uint32
+	freq uint32
+	done bool
+}
+
+// next moves to the next posting, returning false at the end of the list.
+func (c *postingCursor) next() bool {
+	if len(c.data) == 0 {
+		c.done = true
+		return false
+	}
+	delta, n := binary.Uvarint(c.data)
+	c.data = c.data[n:]
+	freq, n := binary.Uvarint(c.data)
+	c.data = c.data[n:]
+	c.num += uint32(delta)
+	c.freq = uint32(freq)
+	return true
+}
+
+// seek moves to the first posting of a document numbered target or more.
+// Posting lists have no skip pointers, the postings before are decoded.
+func (c *postingCursor) seek(target uint32) {
+	for !c.done && c.num < target {
+		c.next()
+	}
+}
+
+// mergeIndexes combines indexes into a new one, numbering their documents
+// in order and keeping those for which keep is true.
+func mergeIndexes(indexes []*InvertedIndex, keep func(i int, docID string) bool) *InvertedIndex {
+	merged := NewInvertedIndex()
+	renumbered := make([][]uint32, len(indexes))
+	kept := make([][]bool, len(indexes))
+	for i, index := range indexes {
+		renumbered[i] = make([]uint32, len(index.Docs))
+		kept[i] = make([]bool, len(index.Docs))
+		for num, doc := range index.Docs {
+			if doc.DocID == "" || !keep(i, doc.DocID) {
+				continue
+			}
+			renumbered[i][num] = uint32(len(merged.Docs))
+			kept[i][num] = true
+			merged.DocNums[doc.DocID] = uint32(len(merged.Docs))
+			merged.Docs = append(merged.Docs, doc)
+		}
+	}
+	for i, index := range indexes {
+		for token, list := range index.Lists {
+			list.each(func(n uint32, freq uint32) {
+				if !kept[i][n] {
+					return
+				}
+				mergedList, ok := merged.Lists[token]
+				if !ok {
+					mergedList = &postingList{}
+					merged.Lists[token] = mergedList
+				}
+				mergedList.appendScaled(renumbered[i][n], freq)
+			})
+		}
+	}
+	for _, index := range indexes {
+		merged.Timestamp = max(merged.Timestamp, index.Timestamp)
+	}
+	return merged
+}
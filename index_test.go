@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"DocuStore/search"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+func TestInvertedIndex(t *testing.T) {
+	index := NewInvertedIndex()
+	docs := make([]*search.DocSummary, 100)
+	for i := range docs {
+		text := fmt.Sprintf("common word%d group%d", i, i%10)
+		docs[i] = search.NewDocSummary(text, fmt.Sprint(i), fmt.Sprint(i), search.Text)
+		index.InsertDoc(docs[i], search.DefaultFieldBoosts, int64(i))
+	}
+	if got := index.SearchTokens([]string{"word17", "group7"}); len(got) != 10 || got[0] != docs[17].DocID {
+		t.Errorf("unexpected documents %v", got)
+	}
+	postings := index.Postings("common")
+	if len(postings) != 100 || math.Abs(postings[0].Freq-1.0/3) > 1e-4 {
+		t.Errorf("unexpected postings %v", postings[:1])
+	}
+
+	// removing most documents compacts the document numbers
+	for _, doc := range docs[:90] {
+		index.RemoveDoc(doc, 100)
+	}
+	index.InsertDoc(docs[5], search.DefaultFieldBoosts, 101)
+	if index.NumDocs() != 11 || len(index.Docs) > 2*index.NumDocs() {
+		t.Errorf("%d documents with %d numbers", index.NumDocs(), len(index.Docs))
+	}
+	expected := []string{docs[95].DocID, docs[5].DocID}
+	if got := index.SearchTokens([]string{"word95", "word5"}); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := index.SearchTokens([]string{"word50"}); len(got) != 0 {
+		t.Errorf("removed document found: %v", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.gob")
+	if err := SaveStruct(path, index); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInvertedIndex()
+	if err := LoadStruct(path, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Timestamp != 101 || !slices.Equal(loaded.SearchTokens([]string{"common"}), index.SearchTokens([]string{"common"})) {
+		t.Error("loaded index differs")
+	}
+}
+
+func TestSegmentedIndexConformance(t *testing.T) {
+	testIndex(t, func(dir string) (Index, error) {
+		index, err := OpenSegmentedIndex(dir, search.DefaultFieldBoosts, logger.NewDefaultLogger())
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return index, err
+	})
+}
+
+// testIndex checks that an Index implementation behaves as the engine
+// expects. open must create an empty index in an empty folder, and load the
+// index closed in the folder otherwise.
+func testIndex(t *testing.T, open func(dir string) (Index, error)) {
+	newDoc := func(text string, identifier string) *search.DocSummary {
+		return search.NewDocSummary(text, identifier, identifier, search.Text)
+	}
+	mustOpen := func(t *testing.T, dir string) Index {
+		t.Helper()
+		index, err := open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { index.Close() })
+		return index
+	}
+	mustInsert := func(t *testing.T, index Index, docs ...*search.DocSummary) {
+		t.Helper()
+		for i, doc := range docs {
+			if err := index.InsertDoc(doc, int64(i+1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	mustSearch := func(t *testing.T, index Index, query string, k int) []*search.SearchResult {
+		t.Helper()
+		results, err := index.Search(context.Background(), search.TermFrequencies(query), k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+	expectDocs := func(t *testing.T, index Index, tokens []string, expected ...*search.DocSummary) {
+		t.Helper()
+		var expectedIDs []string
+		for _, doc := range expected {
+			expectedIDs = append(expectedIDs, doc.DocID)
+		}
+		found := index.SearchTokens(tokens)
+		slices.Sort(found)
+		slices.Sort(expectedIDs)
+		if !slices.Equal(found, expectedIDs) {
+			t.Errorf("%v found in %d documents, expected %d", tokens, len(found), len(expectedIDs))
+		}
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		index := mustOpen(t, t.TempDir())
+		// the first token of the first document must not be lost
+		first := newDoc("aardvark", "first")
+		second := newDoc("aardvark bison", "second")
+		mustInsert(t, index, first, second)
+		expectDocs(t, index, []string{"aardvark"}, first, second)
+		expectDocs(t, index, []string{"aardvark", "bison", "aardvark"}, first, second)
+		expectDocs(t, index, []string{"missing"})
+		if index.NumDocs() != 2 || index.Timestamp() != 2 {
+			t.Errorf("%d documents at %d", index.NumDocs(), index.Timestamp())
+		}
+
+		// replacing a document drops its previous tokens
+		replaced := newDoc("cat", "first")
+		if err := index.InsertDoc(replaced, 3); err != nil {
+			t.Fatal(err)
+		}
+		expectDocs(t, index, []string{"aardvark"}, second)
+		expectDocs(t, index, []string{"cat", "bison"}, replaced, second)
+		if counter := index.Counter(); counter.NumDocs != 2 || counter.DocCounts["aardvark"] != 1 {
+			t.Errorf("unexpected counts %d, %v", counter.NumDocs, counter.DocCounts)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		index := mustOpen(t, t.TempDir())
+		a, b := newDoc("apple banana", "a"), newDoc("banana cherry", "b")
+		mustInsert(t, index, a, b)
+		if err := index.RemoveDoc(a, 5); err != nil {
+			t.Fatal(err)
+		}
+		expectDocs(t, index, []string{"apple", "banana"}, b)
+		if summaries := index.Summaries(a.DocID, b.DocID); len(summaries) != 1 || summaries[0].Title != "b" {
+			t.Errorf("unexpected summaries %v", summaries)
+		}
+		if counter := index.Counter(); counter.NumDocs != 1 || counter.DocCounts["apple"] != 0 || index.Timestamp() != 5 {
+			t.Errorf("unexpected counts %d, %v at %d", counter.NumDocs, counter.DocCounts, index.Timestamp())
+		}
+		// removing a missing document is not an error
+		if err := index.RemoveDoc(a, 6); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		index := mustOpen(t, t.TempDir())
+		docs := []*search.DocSummary{
+			newDoc("spark tuning spark executors", "tuning"),
+			newDoc("a note mentioning spark once among other words", "mention"),
+			newDoc("bread flour water", "bread"),
+		}
+		mustInsert(t, index, docs...)
+		results := mustSearch(t, index, "spark executors", 10)
+		if len(results) != 2 || results[0].DocID != docs[0].DocID || results[0].Score <= results[1].Score {
+			t.Fatalf("unexpected results %+v", results)
+		}
+		if results[0].Title != "tuning" || results[0].Identifier != "tuning" || results[0].Type != search.Text.String() {
+			t.Errorf("unexpected result %+v", results[0])
+		}
+		if results := mustSearch(t, index, "spark", 1); len(results) != 1 {
+			t.Errorf("%d results, expected 1", len(results))
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := index.Search(ctx, search.TermFrequencies("spark"), 1); !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled search returned %v", err)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		index := mustOpen(t, t.TempDir())
+		mustInsert(t, index, newDoc("old", "old"))
+		docs := NewInvertedIndex()
+		fresh := newDoc("fresh", "fresh")
+		docs.InsertDoc(fresh, search.DefaultFieldBoosts, 7)
+		if err := index.Reset(docs, 7); err != nil {
+			t.Fatal(err)
+		}
+		expectDocs(t, index, []string{"old", "fresh"}, fresh)
+		if index.NumDocs() != 1 || index.Counter().DocCounts["old"] != 0 || index.Timestamp() != 7 {
+			t.Errorf("%d documents at %d", index.NumDocs(), index.Timestamp())
+		}
+	})
+
+	t.Run("persist", func(t *testing.T) {
+		dir := t.TempDir()
+		index := mustOpen(t, dir)
+		docs := make([]*search.DocSummary, 50)
+		for i := range docs {
+			docs[i] = newDoc(fmt.Sprintf("common word%d", i), fmt.Sprint(i))
+		}
+		mustInsert(t, index, docs...)
+		if err := index.RemoveDoc(docs[0], 60); err != nil {
+			t.Fatal(err)
+		}
+		if err := index.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		reloaded := mustOpen(t, dir)
+		expectDocs(t, reloaded, []string{"common"}, docs[1:]...)
+		if reloaded.Timestamp() != 60 || reloaded.Counter().DocCounts["common"] != 49 {
+			t.Errorf("timestamp %d and %d documents after reload", reloaded.Timestamp(), reloaded.Counter().DocCounts["common"])
+		}
+		// inserting a reloaded document again does not duplicate it
+		if err := reloaded.InsertDoc(docs[1], 61); err != nil {
+			t.Fatal(err)
+		}
+		expectDocs(t, reloaded, []string{"common", "word1"}, docs[1:]...)
+		if len(mustSearch(t, reloaded, "word1", 10)) != 1 {
+			t.Error("duplicate search results after reload")
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		index := mustOpen(t, t.TempDir())
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 25; i++ {
+					doc := newDoc(fmt.Sprintf("shared writer%d item%d", w, i), fmt.Sprintf("%d-%d", w, i))
+					if err := index.InsertDoc(doc, int64(i)); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 25; i++ {
+					index.SearchTokens([]string{"shared"})
+					index.Search(context.Background(), search.TermFrequencies("shared item3"), 5)
+				}
+			}()
+		}
+		wg.Wait()
+		if err := index.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(index.SearchTokens([]string{"shared"})); n != 100 || index.NumDocs() != 100 {
+			t.Errorf("%d documents after concurrent inserts, expected 100", n)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// number of bytes looked at to tell text from binary files, as git does
+const sniffLength = 8000
+
+// IngestOptions selects the files added from a directory. Patterns are globs
+// matched against the file name, or against the path relative to the
+// directory if they contain a slash. "**" matches any number of folders.
+type IngestOptions struct {
+	Include []string // if not empty, only matching files are added
+	Exclude []string
+	// skip the files ignored by .gitignore files in the directory
+	Gitignore bool
+}
+
+type IngestSummary struct {
+	Added   int
+	Skipped int
+	Failed  map[string]error
+}
+
+// AddDirectory adds every text file under root. Hidden, binary, empty and
+// excluded files are skipped, as are files already in the collection or
+// refused as near-duplicates. A failing file does not stop the others.
+// Cancelling ctx stops at the next file.
+func (e *DocuEngine) AddDirectory(ctx context.Context, root string, opts IngestOptions) (*IngestSummary, error) {
+	summary := &IngestSummary{Failed: make(map[string]error)}
+	ignores := make(map[string][]ignoreRule)
+	err := filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			summary.Failed[filePath] = err
+			return nil
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "." && strings.HasPrefix(d.Name(), ".") {
+			// hidden files and folders, .git included
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if rel == "." {
+				rel = ""
+			} else if opts.Gitignore && isIgnored(ignores, rel, true) {
+				return filepath.SkipDir
+			}
+			if opts.Gitignore {
+				rules, err := readGitignore(filepath.Join(filePath, ".gitignore"), rel)
+				if err != nil {
+					summary.Failed[filepath.Join(filePath, ".gitignore")] = err
+				}
+				ignores[rel] = rules
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() ||
+			(opts.Gitignore && isIgnored(ignores, rel, false)) ||
+			(len(opts.Include) > 0 && !matchAny(opts.Include, rel)) ||
+			matchAny(opts.Exclude, rel) {
+			summary.Skipped++
+			return nil
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			summary.Failed[filePath] = err
+			return nil
+		}
+		text := strings.TrimSpace(string(content))
+		if text == "" || isBinary(content) {
+			e.log.Debug(fmt.Sprintf("skipping %s", filePath))
+			summary.Skipped++
+			return nil
+		}
+		_, err = e.addTextFile(text, filePath)
+		if errors.Is(err, ErrDuplicate) || errors.Is(err, ErrNearDuplicate) {
+			e.log.Debug(fmt.Sprintf("skipping %s: %s", filePath, err))
+			summary.Skipped++
+			return nil
+		}
+		if err != nil {
+			summary.Failed[filePath] = err
+			return nil
+		}
+		summary.Added++
+		return nil
+	})
+	return summary, err
+}
+
+// isBinary guesses whether content is a binary file, from the presence of NUL
+// bytes and the sniffed content type.
+func isBinary(content []byte) bool {
+	sniff := content[:min(len(content), sniffLength)]
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return true
+	}
+	contentType := http.DetectContentType(sniff)
+	if strings.HasPrefix(contentType, "text/") {
+		return false
+	}
+	return !utf8.Valid(content)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated relative path against pattern. Patterns
+// without a slash only look at the last element of the path.
+func matchGlob(pattern string, rel string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "/")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern []string, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// ignoreRule is a line of a .gitignore file.
+type ignoreRule struct {
+	pattern string // relative to the directory of the .gitignore file
+	negate  bool
+	dirOnly bool
+}
+
+// readGitignore reads the rules of the .gitignore file at gitignorePath, if
+// it exists. dir is the directory of the file, relative to the root.
+func readGitignore(gitignorePath string, dir string) ([]ignoreRule, error) {
+	file, err := os.Open(gitignorePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if !strings.Contains(line, "/") {
+			// a bare name matches at any depth
+			line = "**/" + line
+		}
+		line = strings.TrimPrefix(line, "/")
+		if dir != "" {
+			line = dir + "/" + line
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// isIgnored applies the .gitignore rules of every directory above rel, the
+// last matching rule wins.
+func isIgnored(ignores map[string][]ignoreRule, rel string, isDir bool) bool {
+	dirs := []string{""}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		dirs = append(dirs, strings.Join(parts[:i], "/"))
+	}
+	ignored := false
+	for _, dir := range dirs {
+		for _, rule := range ignores[dir] {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if matchSegments(strings.Split(rule.pattern, "/"), parts) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
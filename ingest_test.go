@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		match   bool
+	}{
+		{"*.md", "notes.md", true},
+		{"*.md", "docs/notes.md", true},
+		{"*.md", "notes.txt", false},
+		{"docs/*.md", "docs/notes.md", true},
+		{"docs/*.md", "docs/sub/notes.md", false},
+		{"docs/*.md", "other/docs/notes.md", false},
+		{"/docs/*.md", "docs/notes.md", true},
+		{"**/*.md", "notes.md", true},
+		{"**/*.md", "a/b/notes.md", true},
+		{"docs/**", "docs/a/b.md", true},
+		{"docs/**", "other/b.md", false},
+		{"docs/**/notes.md", "docs/notes.md", true},
+		{"docs/**/notes.md", "docs/a/b/notes.md", true},
+		{"docs/**/notes.md", "docs/a/b/other.md", false},
+	}
+	for _, test := range tests {
+		if match := matchGlob(test.pattern, test.rel); match != test.match {
+			t.Errorf("matchGlob(%q, %q) = %v", test.pattern, test.rel, match)
+		}
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	dir := t.TempDir()
+	writeNote(t, filepath.Join(dir, ".gitignore"), strings.Join([]string{
+		"# comment",
+		"*.log",
+		"!keep.log",
+		"/build",
+		"cache/",
+		"docs/*.tmp",
+		`\#hash.md`,
+	}, "\n"))
+	writeNote(t, filepath.Join(dir, "sub", ".gitignore"), "draft.md\n")
+	ignores := make(map[string][]ignoreRule)
+	for _, rel := range []string{"", "sub"} {
+		rules, err := readGitignore(filepath.Join(dir, rel, ".gitignore"), rel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ignores[rel] = rules
+	}
+	rules, err := readGitignore(filepath.Join(dir, "missing", ".gitignore"), "missing")
+	if err != nil || rules != nil {
+		t.Errorf("missing .gitignore read as %v, %v", rules, err)
+	}
+
+	tests := []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"debug.log", false, true},
+		{"a/b/debug.log", false, true},
+		{"keep.log", false, false},
+		{"a/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, true},
+		{"a/build", true, false},
+		{"cache", true, true},
+		{"a/cache", true, true},
+		{"cache", false, false},
+		{"docs/x.tmp", false, true},
+		{"docs/a/x.tmp", false, false},
+		{"#hash.md", false, true},
+		{"sub/draft.md", false, true},
+		{"sub/a/draft.md", false, true},
+		{"draft.md", false, false},
+		{"notes.md", false, false},
+	}
+	for _, test := range tests {
+		if ignored := isIgnored(ignores, test.rel, test.isDir); ignored != test.ignored {
+			t.Errorf("isIgnored(%q, %v) = %v", test.rel, test.isDir, ignored)
+		}
+	}
+}
+
+func TestAddDirectory(t *testing.T) {
+	ctx := context.Background()
+	engine := openTestEngine(t)
+	dir := t.TempDir()
+	writeNote(t, filepath.Join(dir, ".gitignore"), "ignored/\n")
+	writeNote(t, filepath.Join(dir, "spark.md"), "# Spark\nexecutor memory and cores")
+	writeNote(t, filepath.Join(dir, "sub", "kafka.txt"), "kafka partitions and consumer groups")
+	writeNote(t, filepath.Join(dir, "ignored", "draft.md"), "draft note")
+	writeNote(t, filepath.Join(dir, "empty.txt"), "  \n")
+	err := os.WriteFile(filepath.Join(dir, "image.bin"), []byte{0x89, 'P', 'N', 'G', 0, 0, 1}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := IngestOptions{Exclude: []string{"*.bin"}, Gitignore: true}
+	summary, err := engine.AddDirectory(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 2 || summary.Skipped != 2 || len(summary.Failed) != 0 {
+		t.Errorf("first import: %d added, %d skipped, failed %v", summary.Added, summary.Skipped, summary.Failed)
+	}
+
+	// documents already in the collection are skipped
+	summary, err = engine.AddDirectory(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 0 || summary.Skipped != 4 || len(summary.Failed) != 0 {
+		t.Errorf("second import: %d added, %d skipped, failed %v", summary.Added, summary.Skipped, summary.Failed)
+	}
+
+	// so are near-duplicates when they are refused
+	engine.refuseNearDuplicates = true
+	copyDir := t.TempDir()
+	writeNote(t, filepath.Join(copyDir, "spark copy.md"), "# Spark\nexecutor memory and cores!")
+	summary, err = engine.AddDirectory(ctx, copyDir, IngestOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 0 || summary.Skipped != 1 || len(summary.Failed) != 0 {
+		t.Errorf("near-duplicate import: %d added, %d skipped, failed %v", summary.Added, summary.Skipped, summary.Failed)
+	}
+}
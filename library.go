@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"DocuStore/search"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+// defaultLibrary is stored in the data folder itself, so that collections
+// created before libraries existed are kept. Other libraries have a folder
+// of their own in librariesFolder.
+const defaultLibrary = "default"
+
+const librariesFolder = "libraries"
+
+var libraryNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+func checkLibraryName(name string) error {
+	if !libraryNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid library name %q: use letters, digits, - and _", name)
+	}
+	return nil
+}
+
+// libraryFolder returns the folder storing the library name in dataDir.
+func libraryFolder(dataDir string, name string) string {
+	if name == "" || name == defaultLibrary {
+		return dataDir
+	}
+	return filepath.Join(dataDir, librariesFolder, name)
+}
+
+// ListLibraries returns the names of the libraries in dataDir, the default
+// one first.
+func ListLibraries(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dataDir, librariesFolder))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && checkLibraryName(entry.Name()) == nil && entry.Name() != defaultLibrary {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return append([]string{defaultLibrary}, names...), nil
+}
+
+// CreateLibrary creates an empty library in dataDir.
+func CreateLibrary(dataDir string, name string) error {
+	err := checkLibraryName(name)
+	if err != nil {
+		return err
+	}
+	if name == defaultLibrary {
+		return fmt.Errorf("library %s already exists", name)
+	}
+	err = os.MkdirAll(filepath.Join(dataDir, librariesFolder), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Mkdir(libraryFolder(dataDir, name), 0755)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("library %s already exists", name)
+	}
+	return err
+}
+
+// checkLibraryExists returns an error wrapping ErrNoLibrary if the library
+// name was not created, so that a typo does not start a new library.
+func checkLibraryExists(dataDir string, name string) error {
+	if name == "" || name == defaultLibrary {
+		return nil
+	}
+	_, err := os.Stat(libraryFolder(dataDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s, create it first", ErrNoLibrary, name)
+	}
+	return err
+}
+
+// LoadLibraryText reads the content of a document of a library of dataDir,
+// from its database alone.
+func LoadLibraryText(dataDir string, library string, docID string) (string, error) {
+	err := checkLibraryExists(dataDir, library)
+	if err != nil {
+		return "", err
+	}
+	db, err := NewReadOnlyDBConnection(filepath.Join(libraryFolder(dataDir, library), "storage.db"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	return LoadText(db, docID)
+}
+
+// openLibraryReadOnly opens the library name of the data folder of config
+// for searching, without writing anything: migrations are not applied, an
+// index out of date is rebuilt in memory, and no embedding is computed. If
+// nothing was ever stored in the library, the error wraps os.ErrNotExist.
+func openLibraryReadOnly(config *Config, name string) (*DocuEngine, error) {
+	err := checkLibraryExists(config.DataDir, name)
+	if err != nil {
+		return nil, err
+	}
+	log := config.newLogger()
+	dataFolder := libraryFolder(config.DataDir, name)
+	db, err := NewReadOnlyDBConnection(filepath.Join(dataFolder, "storage.db"))
+	if err != nil {
+		return nil, err
+	}
+	engine, err := openReadOnlyEngine(config, name, dataFolder, db, log)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return engine, nil
+}
+
+func openReadOnlyEngine(config *Config, name string, dataFolder string, db *sql.DB, log logger.Logger) (*DocuEngine, error) {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return nil, err
+	}
+	if version < len(migrations) {
+		return nil, fmt.Errorf("library %s was stored by a previous version, open it once to upgrade it", name)
+	}
+	latestTs, err := GetLatestTimestamp(db)
+	if err != nil {
+		return nil, err
+	}
+	boosts := config.fieldBoosts()
+	index, err := OpenReadOnlySegmentedIndex(filepath.Join(dataFolder, indexFolder), boosts, log)
+	if err != nil || index.Timestamp() != latestTs {
+		log.Debug(fmt.Sprintf("index of library %s unavailable or out of date, rebuilding it in memory", name))
+		err = recoverIndex(index, db, boosts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	engine, err := newEngine(config, name, dataFolder, db, index, log)
+	if err != nil {
+		return nil, err
+	}
+	engine.readOnly = true
+	return engine, nil
+}
+
+// SearchLibraries runs a query in several libraries of the data folder of
+// config. Scores of different libraries are not comparable, so rankings are
+// merged with reciprocal rank fusion. Each result carries the name of its
+// library. The library of e is searched by e, the others are opened
+// read-only for the search and share its embedding model and search mode.
+// Their documents without a vector of the model are only found by keywords.
+func (e *DocuEngine) SearchLibraries(ctx context.Context, config *Config, names []string, text string) ([]*search.SearchResult, error) {
+	e.mu.RLock()
+	embedder, mode := e.embedder, e.searchMode
+	e.mu.RUnlock()
+
+	var lists [][]*search.SearchResult
+	for _, name := range names {
+		engine := e
+		if libraryFolder(config.DataDir, name) != e.dataFolder {
+			var err error
+			engine, err = openLibraryReadOnly(config, name)
+			if errors.Is(err, os.ErrNotExist) {
+				// nothing stored yet
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("opening library %s: %w", name, err)
+			}
+			defer engine.Close()
+			if embedder != nil {
+				err = engine.useEmbedder(embedder)
+				if err == nil {
+					err = engine.SetSearchMode(mode)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		results, err := engine.QueryDocument(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			result.Library = name
+		}
+		lists = append(lists, results)
+	}
+	return search.FuseRRF(lists...), nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLibraries(t *testing.T) {
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	if err := CreateLibrary(config.DataDir, "work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateLibrary(config.DataDir, "work"); err == nil {
+		t.Error("a library was created twice")
+	}
+	if err := CreateLibrary(config.DataDir, "../escape"); err == nil {
+		t.Error("an invalid library name was accepted")
+	}
+	libraries, err := ListLibraries(config.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(libraries, []string{"default", "work"}) {
+		t.Errorf("libraries %v", libraries)
+	}
+
+	missing := *config
+	missing.Library = "personal"
+	if _, err = NewEngine(&missing); !errors.Is(err, ErrNoLibrary) {
+		t.Errorf("opening a library that was not created returned %v", err)
+	}
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	_, err = engine.AddText("a recipe for sourdough bread", "bread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := *config
+	work.Library = "work"
+	workEngine, err := NewEngine(&work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workID, err := workEngine.AddText("quarterly report on bread sales", "report")
+	workEngine.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// libraries do not share documents
+	ctx := context.Background()
+	results, err := engine.QueryDocument(ctx, "bread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Title != "bread" {
+		t.Errorf("default library results %+v", results)
+	}
+
+	results, err = engine.SearchLibraries(ctx, config, libraries, "bread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]string)
+	for _, result := range results {
+		found[result.Title] = result.Library
+	}
+	if len(results) != 2 || found["bread"] != "default" || found["report"] != "work" {
+		t.Errorf("results across libraries %+v", found)
+	}
+	content, err := LoadLibraryText(config.DataDir, "work", workID)
+	if err != nil || content != "quarterly report on bread sales" {
+		t.Errorf("reading a document of another library returned %q, %v", content, err)
+	}
+}
+
+func TestSearchLibrariesReadOnly(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	words := loadWords(t)
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	for _, name := range []string{"work", "empty"} {
+		if err := CreateLibrary(config.DataDir, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	work := *config
+	work.Library = "work"
+	workEngine, err := NewEngine(&work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_, err = workEngine.AddText(fmt.Sprintf("bread report %d %s", i, randomQuery(rng, words, 10)), fmt.Sprintf("report %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	workEngine.Close()
+	// an index out of date is rebuilt in memory only
+	workFolder := libraryFolder(config.DataDir, "work")
+	err = os.RemoveAll(filepath.Join(workFolder, indexFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := openTestEngine(t)
+	err = engine.EnableEmbeddings(writeWordVectors(t, rng, words[:1000]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	libraries := []string{"default", "work", "empty"}
+	for i := 0; i < 2; i++ {
+		results, err := engine.SearchLibraries(context.Background(), config, libraries, "bread report")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 5 || results[0].Library != "work" {
+			t.Errorf("results across libraries %+v", results)
+		}
+	}
+
+	entries, err := os.ReadDir(workFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "storage.db" {
+			t.Errorf("%s written by a search", entry.Name())
+		}
+	}
+	db, err := NewReadOnlyDBConnection(filepath.Join(workFolder, "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	missing, err := ListUnembeddedDocuments(db, engine.embedder.ID())
+	if err != nil || len(missing) != 5 {
+		t.Errorf("%d documents left without a vector: %v", len(missing), err)
+	}
+	if _, err = os.Stat(filepath.Join(libraryFolder(config.DataDir, "empty"), "storage.db")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("empty library database created by a search: %v", err)
+	}
+}
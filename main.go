@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
 
 	"DocuStore/scraper"
 
@@ -16,9 +20,56 @@ import (
 //go:embed all:frontend/dist
 var assets embed.FS
 
-func runApp() {
+var globalFlags = registerConfigFlags(flag.CommandLine)
+
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// exit codes of the command line interface
+const (
+	exitFailure     = 1
+	exitUsage       = 2 // as the flag package on invalid flags
+	exitNotFound    = 3
+	exitDuplicate   = 4
+	exitFetchFailed = 5
+	exitCorrupted   = 6
+	exitInterrupted = 130
+)
+
+// exitCode returns the exit code of a command that failed with err.
+func exitCode(err error) int {
+	var fetchErr *scraper.FetchError
+	var usageErr *usageError
+	switch {
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNoLibrary):
+		return exitNotFound
+	case errors.Is(err, ErrDuplicate), errors.Is(err, ErrNearDuplicate):
+		return exitDuplicate
+	case errors.As(err, &fetchErr):
+		return exitFetchFailed
+	case errors.Is(err, ErrCorrupted):
+		return exitCorrupted
+	}
+	return exitFailure
+}
+
+func runApp(config *Config) {
 	// Create an instance of the app structure
-	app := NewApp()
+	app := NewApp(config)
+	logLevel, _ := logger.StringToLogLevel(config.LogLevel)
 
 	// Create application with options
 	err := wails.Run(&options.App{
@@ -28,7 +79,7 @@ func runApp() {
 		WindowStartState:   options.Normal,
 		Frameless:          false,
 		MinWidth:           300,
-		LogLevel:           logger.DEBUG,
+		LogLevel:           logLevel,
 		LogLevelProduction: logger.WARNING,
 		AssetServer: &assetserver.Options{
 			Assets: assets,
@@ -40,61 +91,48 @@ func runApp() {
 	})
 
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
 	}
 }
 
-func cliInterface() {
-	var err error
-	engine, err := NewEngine()
-	if err != nil {
-		panic(err)
+// runNativeHost serves a browser extension that started the binary as its
+// native messaging host. stdout belongs to the protocol, errors go to stderr.
+// Browsers pass no flags, so only the configuration file and the environment
+// apply.
+func runNativeHost() {
+	config, err := LoadConfig("")
+	var engine *DocuEngine
+	if err == nil {
+		engine, err = NewEngine(config)
 	}
-
-	cmd := flag.Arg(0)
-	switch cmd {
-	case "add":
-		fmt.Println("adding document")
-		arg := flag.Arg(1)
-		if arg == "" {
-			fmt.Println("You must provide a valid file path or URL.")
-			return
-		}
-		found := scraper.URLRegex.FindString(arg)
-		if found != "" {
-			err = engine.AddURL(arg)
-			if err != nil {
-				panic(err)
-			}
-		} else {
-			err = engine.addFile(arg)
-			if err != nil {
-				panic(err)
-			}
-		}
-	case "query":
-		fmt.Println("querying documents")
-		query := flag.Arg(1)
-		if query == "" {
-			fmt.Println("You must provide a query string.")
-			return
-		}
-		result, err := engine.QueryDocument(query)
-		if err != nil {
-			panic(err)
-		}
-		printSearchResults(result)
-	default:
-		fmt.Println("Valid commands: add, query")
+	if err == nil {
+		err = engine.RunNativeHost(context.Background(), os.Stdin, os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
 	}
 }
 
 func main() {
+	// browsers pass arguments of their own, which are not valid flags
+	if isNativeMessagingLaunch(os.Args[1:]) {
+		runNativeHost()
+		return
+	}
+	flag.Usage = func() { printUsage(os.Stderr) }
 	flag.Parse()
+	config, err := globalFlags.load(flag.CommandLine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(exitFailure)
+	}
 
 	if flag.NArg() < 1 {
-		runApp()
-	} else {
-		cliInterface()
+		runApp(config)
+	} else if err := cliInterface(config, flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(exitCode(err))
 	}
 }
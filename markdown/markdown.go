@@ -0,0 +1,166 @@
+// Package markdown extracts the plain text and metadata of Markdown notes, so
+// that syntax characters and link URLs do not end up in the index.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v3"
+)
+
+type Document struct {
+	Title    string   // from the front matter, or the first level 1 heading
+	Tags     []string // from the front matter
+	Headings []string
+	Text     string // plain text, headings included
+}
+
+var parser = goldmark.DefaultParser()
+
+// Parse parses a Markdown document with optional YAML (---) or TOML (+++)
+// front matter. Front matter that fails to parse is treated as Markdown.
+func Parse(source []byte) *Document {
+	doc := &Document{}
+	meta, body, ok := splitFrontMatter(source)
+	if ok {
+		doc.Title = stringValue(meta["title"])
+		doc.Tags = append(tagsValue(meta["tags"]), tagsValue(meta["tag"])...)
+		source = body
+	}
+
+	var buffer bytes.Buffer
+	root := parser.Parse(text.NewReader(source))
+	ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock {
+				buffer.WriteString("\n")
+			}
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Heading:
+			heading := inlineText(node, source)
+			if node.Level == 1 && doc.Title == "" {
+				doc.Title = heading
+			}
+			doc.Headings = append(doc.Headings, heading)
+			buffer.WriteString(heading)
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			buffer.Write(node.Segment.Value(source))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				buffer.WriteString("\n")
+			}
+		case *ast.String:
+			buffer.Write(node.Value)
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				buffer.Write(segment.Value(source))
+			}
+		case *ast.AutoLink, *ast.RawHTML, *ast.HTMLBlock:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	doc.Text = strings.TrimSpace(buffer.String())
+	return doc
+}
+
+// inlineText returns the text of the inline children of n.
+func inlineText(n ast.Node, source []byte) string {
+	var buffer bytes.Buffer
+	ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			buffer.Write(node.Segment.Value(source))
+			if node.SoftLineBreak() {
+				buffer.WriteString(" ")
+			}
+		case *ast.String:
+			buffer.Write(node.Value)
+		case *ast.AutoLink, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buffer.String())
+}
+
+// splitFrontMatter separates the front matter of source from its body.
+func splitFrontMatter(source []byte) (map[string]any, []byte, bool) {
+	first, rest, _ := bytes.Cut(source, []byte("\n"))
+	delimiter := string(bytes.TrimSpace(first))
+	if delimiter != "---" && delimiter != "+++" {
+		return nil, source, false
+	}
+
+	var header []byte
+	body := rest
+	for len(body) > 0 {
+		var line []byte
+		line, body, _ = bytes.Cut(body, []byte("\n"))
+		trimmed := string(bytes.TrimSpace(line))
+		if trimmed == delimiter || (delimiter == "---" && trimmed == "...") {
+			meta := make(map[string]any)
+			var err error
+			if delimiter == "---" {
+				err = yaml.Unmarshal(header, &meta)
+			} else {
+				err = toml.Unmarshal(header, &meta)
+			}
+			if err != nil {
+				return nil, source, false
+			}
+			return meta, body, true
+		}
+		header = append(header, line...)
+		header = append(header, '\n')
+	}
+	return nil, source, false
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+}
+
+// tagsValue reads tags given as a list or as a comma or space separated
+// string. The leading # of Obsidian-style tags is dropped.
+func tagsValue(value any) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+	case []any:
+		for _, item := range v {
+			values = append(values, stringValue(item))
+		}
+	}
+	var tags []string
+	for _, tag := range values {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
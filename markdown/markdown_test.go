@@ -0,0 +1,77 @@
+package markdown
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		source   string
+		title    string
+		tags     []string
+		headings []string
+	}{
+		{
+			name:     "yaml",
+			source:   "---\ntitle: Spark tuning\ntags: [spark, \"#performance\"]\n---\n# Executors\nSet [memory](https://spark.apache.org/docs) **carefully**.\n",
+			title:    "Spark tuning",
+			tags:     []string{"spark", "performance"},
+			headings: []string{"Executors"},
+		},
+		{
+			name:     "yaml list",
+			source:   "---\ntags:\n  - go\n  - notes\n---\nSome text.\n",
+			tags:     []string{"go", "notes"},
+			headings: nil,
+		},
+		{
+			name:     "toml",
+			source:   "+++\ntitle = \"Go notes\"\ntags = [\"go\"]\n+++\n## Channels\nUse `select`.\n",
+			title:    "Go notes",
+			tags:     []string{"go"},
+			headings: []string{"Channels"},
+		},
+		{
+			name:     "heading",
+			source:   "Intro\n\n## First\n# The *real* title\n",
+			title:    "The real title",
+			headings: []string{"First", "The real title"},
+		},
+		{
+			name:     "thematic break",
+			source:   "---\nnot: [front matter\n---\nText\n",
+			headings: []string{"not: [front matter"},
+		},
+	}
+	for _, c := range cases {
+		doc := Parse([]byte(c.source))
+		if doc.Title != c.title {
+			t.Errorf("%s: title %q, expected %q", c.name, doc.Title, c.title)
+		}
+		if !slices.Equal(doc.Tags, c.tags) {
+			t.Errorf("%s: tags %q, expected %q", c.name, doc.Tags, c.tags)
+		}
+		if !slices.Equal(doc.Headings, c.headings) {
+			t.Errorf("%s: headings %q, expected %q", c.name, doc.Headings, c.headings)
+		}
+	}
+}
+
+func TestParseText(t *testing.T) {
+	source := "# Title\n\nA [link](https://example.com/page) and ![an image](img.png), <https://example.com>.\n\n" +
+		"<div>html</div>\n\n```go\nfmt.Println(\"code\")\n```\n\n[ref]: https://example.com/ref\n"
+	text := Parse([]byte(source)).Text
+	for _, want := range []string{"Title", "A link and an image", "fmt.Println(\"code\")"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in %q", want, text)
+		}
+	}
+	for _, unwanted := range []string{"example.com", "img.png", "html", "#", "```"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("unexpected %q in %q", unwanted, text)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"DocuStore/markdown"
+	"DocuStore/scraper"
+	"DocuStore/search"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+// A migration upgrades the database schema or contents. It reports whether
+// stored documents changed, in which case the index files must be rebuilt.
+type migration func(tx *sql.Tx, env *migrationEnv) (bool, error)
+
+// migrationEnv holds the settings of the library that migrations need.
+type migrationEnv struct {
+	// tokenizes reindexed documents as the engine does
+	analyzer search.Analyzer
+	log      logger.Logger
+}
+
+// migrations are applied in order, each exactly once. The number of applied
+// migrations is kept in the user_version pragma, so never reorder them.
+var migrations = []migration{
+	mergeNormalizedURLs,
+	indexFingerprints,
+	reindexMarkdown,
+	indexPageFields,
+	separateSnapshotViews,
+}
+
+func migrateDB(db *sql.DB, dataFolder string, analyzer search.Analyzer, log logger.Logger) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	env := &migrationEnv{analyzer: analyzer, log: log}
+	rebuild := false
+	for i := version; i < len(migrations); i++ {
+		log.Info(fmt.Sprintf("applying database migration %d", i+1))
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		changed, err := migrations[i](tx, env)
+		if err == nil {
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		rebuild = rebuild || changed
+	}
+
+	if rebuild {
+		// a missing index is recovered from the database
+		err = os.RemoveAll(filepath.Join(dataFolder, indexFolder))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeNormalizedURLs moves URL documents to the ID of their normalized URL,
+// merging documents whose URLs only differed in tracking parameters,
+// fragments, trailing slashes and the like.
+func mergeNormalizedURLs(tx *sql.Tx, env *migrationEnv) (bool, error) {
+	rows, err := tx.Query("SELECT doc_id, summary FROM documents")
+	if err != nil {
+		return false, err
+	}
+	order, summaries, err := scanSummaries(rows)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, docID := range order {
+		doc := summaries[docID]
+		if doc.Type != search.URL {
+			continue
+		}
+		normalized, err := scraper.NormalizeURL(doc.Identifier)
+		if err != nil {
+			env.log.Warning(fmt.Sprintf("keeping document with invalid URL %s: %s", doc.Identifier, err))
+			continue
+		}
+		newID := search.DocumentID(normalized)
+		if newID == docID {
+			continue
+		}
+		changed = true
+
+		if _, exists := summaries[newID]; exists {
+			env.log.Info(fmt.Sprintf("merging duplicate document %s into %s", doc.Identifier, normalized))
+			err = deleteMergedDocument(tx, docID, newID)
+			if err != nil {
+				return false, err
+			}
+			delete(summaries, docID)
+			continue
+		}
+
+		doc.DocID = newID
+		doc.Identifier = normalized
+		var buffer bytes.Buffer
+		err = gob.NewEncoder(&buffer).Encode(doc)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(
+			"UPDATE documents SET doc_id = ?, summary = ? WHERE doc_id = ?",
+			newID, buffer.Bytes(), docID,
+		)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("UPDATE OR IGNORE collections SET doc_id = ? WHERE doc_id = ?", newID, docID)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("DELETE FROM collections WHERE doc_id = ?", docID)
+		if err != nil {
+			return false, err
+		}
+		delete(summaries, docID)
+		summaries[newID] = doc
+	}
+	return changed, nil
+}
+
+// deleteMergedDocument removes docID, keeping its collections on keepID.
+func deleteMergedDocument(tx *sql.Tx, docID string, keepID string) error {
+	_, err := tx.Exec(
+		"INSERT OR IGNORE INTO collections (name, doc_id) SELECT name, ? FROM collections WHERE doc_id = ?",
+		keepID, docID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM collections WHERE doc_id = ?", docID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM documents WHERE doc_id = ?", docID)
+	return err
+}
+
+// indexFingerprints computes the SimHash of documents stored before
+// fingerprints existed and stores the bands of every fingerprint, to look up
+// near-duplicates instead of comparing every document. Documents without
+// terms get no fingerprint.
+func indexFingerprints(tx *sql.Tx, env *migrationEnv) (bool, error) {
+	rows, err := tx.Query("SELECT doc_id, summary FROM documents")
+	if err != nil {
+		return false, err
+	}
+	order, summaries, err := scanSummaries(rows)
+	if err != nil {
+		return false, err
+	}
+	for _, docID := range order {
+		doc := summaries[docID]
+		doc.DocID = docID
+		doc.Fingerprint = search.SimHash(doc.TermFreqs)
+		err = insertFingerprint(tx, doc)
+		if err != nil {
+			return false, err
+		}
+	}
+	env.log.Info(fmt.Sprintf("indexed the fingerprints of %d documents", len(order)))
+	return false, nil
+}
+
+// reindexMarkdown indexes the plain text of text documents, which used to be
+// indexed as raw Markdown, and applies the tags of their front matter.
+func reindexMarkdown(tx *sql.Tx, env *migrationEnv) (bool, error) {
+	rows, err := tx.Query("SELECT doc_id, summary FROM documents")
+	if err != nil {
+		return false, err
+	}
+	order, summaries, err := scanSummaries(rows)
+	if err != nil {
+		return false, err
+	}
+
+	reindexed := 0
+	for _, docID := range order {
+		doc := summaries[docID]
+		if doc.Type != search.Text {
+			continue
+		}
+		note := markdown.Parse([]byte(doc.Identifier))
+		fields := markdownFields(note, doc.Title)
+		if fields == nil {
+			continue
+		}
+		err = updateSummary(tx, env.analyzer.NewFieldDocSummary(fields, doc.Identifier, doc.Title, doc.Type))
+		if err != nil {
+			return false, err
+		}
+		for _, tag := range cleanTags(note.Tags) {
+			_, err = tx.Exec("INSERT OR IGNORE INTO tags (doc_id, tag) VALUES (?, ?)", docID, tag)
+			if err != nil {
+				return false, err
+			}
+		}
+		reindexed++
+	}
+	env.log.Info(fmt.Sprintf("reindexed %d text documents as Markdown", reindexed))
+	return reindexed > 0, nil
+}
+
+// indexPageFields indexes the title, headings, URL, description and body of
+// web pages separately. Pages are extracted again from their snapshot, those
+// without one are split into title, URL and content.
+func indexPageFields(tx *sql.Tx, env *migrationEnv) (bool, error) {
+	rows, err := tx.Query("SELECT doc_id, summary FROM documents")
+	if err != nil {
+		return false, err
+	}
+	order, summaries, err := scanSummaries(rows)
+	if err != nil {
+		return false, err
+	}
+
+	reindexed := 0
+	for _, docID := range order {
+		doc := summaries[docID]
+		if doc.Type != search.URL {
+			continue
+		}
+		var html []byte
+		err = tx.QueryRow("SELECT html FROM snapshots WHERE doc_id = ?", docID).Scan(&html)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+		var fields map[search.Field]string
+		if len(html) > 0 {
+			data, err := scraper.ExtractFromHTML(bytes.NewReader(html), doc.Identifier, scraper.DefaultScrapeOptions, env.log)
+			if err == nil {
+				fields = pageFields(doc.Identifier, data)
+			}
+		}
+		if fields == nil {
+			var content []byte
+			err = tx.QueryRow("SELECT content FROM documents WHERE doc_id = ?", docID).Scan(&content)
+			if err != nil {
+				return false, err
+			}
+			fields = map[search.Field]string{
+				search.TitleField: doc.Title,
+				search.URLField:   scraper.URLWords(doc.Identifier),
+				search.BodyField:  string(content),
+			}
+		}
+		err = updateSummary(tx, env.analyzer.NewFieldDocSummary(fields, doc.Identifier, doc.Title, doc.Type))
+		if err != nil {
+			return false, err
+		}
+		reindexed++
+	}
+	env.log.Info(fmt.Sprintf("reindexed %d web pages by field", reindexed))
+	return reindexed > 0, nil
+}
+
+// separateSnapshotViews moves the pages archived before the raw HTML was
+// kept, which were stored as views without scripts, to the single-file
+// views. They can still be opened but are not exported as fetched pages.
+func separateSnapshotViews(tx *sql.Tx, env *migrationEnv) (bool, error) {
+	_, err := tx.Exec("INSERT OR REPLACE INTO inlined_snapshots (doc_id, html) SELECT doc_id, html FROM snapshots WHERE html IS NOT NULL")
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec("UPDATE snapshots SET html = NULL WHERE html IS NOT NULL")
+	if err != nil {
+		return false, err
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	env.log.Info(fmt.Sprintf("kept %d archived pages as views", moved))
+	return false, nil
+}
+
+// updateSummary replaces the summary and fingerprint of a stored document.
+func updateSummary(tx *sql.Tx, doc *search.DocSummary) error {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE documents SET summary = ? WHERE doc_id = ?", buffer.Bytes(), doc.DocID)
+	if err != nil {
+		return err
+	}
+	return insertFingerprint(tx, doc)
+}
+
+// scanSummaries decodes (doc_id, summary) rows, returning the IDs in row
+// order and the summaries by ID. rows is closed.
+func scanSummaries(rows *sql.Rows) ([]string, map[string]*search.DocSummary, error) {
+	defer rows.Close()
+	summaries := make(map[string]*search.DocSummary)
+	var order []string
+	for rows.Next() {
+		var docID string
+		var blob []byte
+		err := rows.Scan(&docID, &blob)
+		if err != nil {
+			return nil, nil, err
+		}
+		doc := &search.DocSummary{}
+		err = gob.NewDecoder(bytes.NewReader(blob)).Decode(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		summaries[docID] = doc
+		order = append(order, docID)
+	}
+	return order, summaries, rows.Err()
+}
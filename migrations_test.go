@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"DocuStore/search"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+func testMigrationEnv() *migrationEnv {
+	return &migrationEnv{analyzer: search.Analyzer{MaxTokenLength: search.DefaultMaxTokenLength}, log: logger.NewDefaultLogger()}
+}
+
+func TestMergeNormalizedURLs(t *testing.T) {
+	db, err := NewDBConnection(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	urls := []string{
+		"https://Example.com:443/page/?utm_source=news#top",
+		"https://example.com/page",
+		"https://example.com/other?b=2&a=1",
+	}
+	for i, url := range urls {
+		doc := search.NewDocSummary(fmt.Sprintf("page number %d", i), url, "title", search.URL)
+		_, err = InsertDocument(db, doc, "content", int64(i+1))
+		if err == nil {
+			err = AddToCollection(db, fmt.Sprintf("collection%d", i), doc.DocID)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	note := search.NewDocSummary("a note", "a note", "note", search.Text)
+	_, err = InsertDocument(db, note, "a note", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := mergeNormalizedURLs(tx, testMigrationEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("no change reported")
+	}
+
+	rows, err := db.Query("SELECT doc_id, summary FROM documents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, summaries, err := scanSummaries(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := search.DocumentID("https://example.com/page")
+	other := search.DocumentID("https://example.com/other?a=1&b=2")
+	if len(summaries) != 3 || summaries[page] == nil || summaries[other] == nil || summaries[note.DocID] == nil {
+		t.Fatalf("documents after the migration: %v", summaries)
+	}
+	if summaries[other].Identifier != "https://example.com/other?a=1&b=2" {
+		t.Errorf("identifier %s was not normalized", summaries[other].Identifier)
+	}
+
+	expected := map[string]string{"collection0": page, "collection1": page, "collection2": other}
+	for collection, docID := range expected {
+		var docIDs []string
+		rows, err := db.Query("SELECT doc_id FROM collections WHERE name = ?", collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var id string
+			rows.Scan(&id)
+			docIDs = append(docIDs, id)
+		}
+		rows.Close()
+		if !slices.Equal(docIDs, []string{docID}) {
+			t.Errorf("%s holds %q, expected %s", collection, docIDs, docID)
+		}
+	}
+}
+
+func TestSeparateSnapshotViews(t *testing.T) {
+	db, err := NewDBConnection(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	view := []byte(`<html><head><base href="https://example.com/"></head></html>`)
+	err = InsertSnapshot(db, "doc", "https://example.com/", view, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = separateSnapshotViews(tx, testMigrationEnv())
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, url, err := LoadSnapshot(db, "doc")
+	if err != nil || html != nil || url != "https://example.com/" {
+		t.Errorf("snapshot %q of %s after the migration, %v", html, url, err)
+	}
+	inlined, err := LoadInlinedSnapshot(db, "doc")
+	if err != nil || string(inlined) != string(view) {
+		t.Errorf("view %q after the migration, %v", inlined, err)
+	}
+	err = EachSnapshot(db, "", func(docID string, url string, timestamp int64, html []byte) error {
+		t.Errorf("%s exported", docID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReindexMarkdown(t *testing.T) {
+	db, err := NewDBConnection(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	text := "# Heading\nkestrels hover over fields"
+	doc := search.NewDocSummary(text, text, "Stored title", search.Text)
+	_, err = InsertDocument(db, doc, text, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := testMigrationEnv()
+	env.analyzer = search.Analyzer{MaxTokenLength: 5}
+	changed, err := reindexMarkdown(tx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("no change reported")
+	}
+
+	rows, err := db.Query("SELECT doc_id, summary FROM documents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, summaries, err := scanSummaries(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reindexed := summaries[doc.DocID]
+	if reindexed == nil || reindexed.Title != "Stored title" {
+		t.Fatalf("document after the migration: %+v", reindexed)
+	}
+	// the stored title is indexed, with the tokens of the configured analyzer
+	title := reindexed.Fields[search.TitleField]
+	if title["store"] == 0 || title["headi"] != 0 {
+		t.Errorf("title field %v", title)
+	}
+	if reindexed.TermFreqs["kestr"] == 0 || reindexed.TermFreqs["kestrels"] != 0 {
+		t.Errorf("terms %v", reindexed.TermFreqs)
+	}
+}
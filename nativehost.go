@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"DocuStore/search"
+)
+
+// name browsers use to find the native messaging host manifest
+const nativeHostName = "docustore"
+
+// browsers send messages of up to 64 MiB but only accept replies up to 1 MiB
+const (
+	maxNativeMessageSize  = 64 << 20
+	maxNativeResponseSize = 1 << 20
+)
+
+var errNativeMessageTooLarge = errors.New("native message is too large")
+
+type nativeRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Action string          `json:"action"`
+	URL    string          `json:"url"`
+	HTML   string          `json:"html"`
+	Query  string          `json:"query"`
+	Limit  int             `json:"limit"`
+}
+
+type nativeResponse struct {
+	ID      json.RawMessage        `json:"id,omitempty"`
+	OK      bool                   `json:"ok"`
+	DocID   string                 `json:"docId,omitempty"`
+	Results []*search.SearchResult `json:"results,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+var (
+	// the origin Chrome passes, with an extension ID of 32 letters a to p
+	chromeOriginRegex = regexp.MustCompile(`^chrome-extension://[a-p]{32}/$`)
+	// Firefox extension IDs are an email-like name or a GUID
+	firefoxIDRegex = regexp.MustCompile(`^([a-zA-Z0-9._+-]*@[a-zA-Z0-9._-]+|\{[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}\})$`)
+)
+
+// isNativeMessagingLaunch reports whether the arguments are the ones a
+// browser passes when starting a native messaging host: the extension origin
+// for Chrome, followed by the parent window on Windows, and the path of our
+// manifest and the extension ID for Firefox.
+func isNativeMessagingLaunch(args []string) bool {
+	if len(args) > 0 && chromeOriginRegex.MatchString(args[0]) {
+		for _, arg := range args[1:] {
+			if !strings.HasPrefix(arg, "--parent-window=") {
+				return false
+			}
+		}
+		return true
+	}
+	return len(args) == 2 &&
+		filepath.IsAbs(args[0]) && filepath.Base(args[0]) == nativeHostName+".json" &&
+		firefoxIDRegex.MatchString(args[1])
+}
+
+// RunNativeHost answers messages from a browser extension, sent with the
+// native messaging protocol, until r is closed or ctx is done.
+func (e *DocuEngine) RunNativeHost(ctx context.Context, r io.Reader, w io.Writer) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var req nativeRequest
+		err := readNativeMessage(r, &req)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		res := e.handleNativeRequest(ctx, &req)
+		res.ID = req.ID
+		err = writeNativeMessage(w, res)
+		if errors.Is(err, errNativeMessageTooLarge) {
+			err = writeNativeMessage(w, &nativeResponse{ID: req.ID, Error: err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *DocuEngine) handleNativeRequest(ctx context.Context, req *nativeRequest) *nativeResponse {
+	var err error
+	res := &nativeResponse{}
+	switch req.Action {
+	case "ping":
+	case "add":
+		url := strings.TrimSpace(req.URL)
+		if url == "" {
+			err = errors.New("missing url")
+		} else if req.HTML != "" {
+			// the page as rendered by the browser, which works behind logins
+			res.DocID, err = e.AddHTML(ctx, []byte(req.HTML), url)
+		} else {
+			res.DocID, err = e.AddURL(ctx, url)
+		}
+		// saving a page again is not an error
+		if errors.Is(err, ErrDuplicate) {
+			err = nil
+		}
+	case "search":
+		res.Results, err = e.QueryDocument(ctx, req.Query)
+		limit := req.Limit
+		if limit <= 0 {
+			limit = 10
+		}
+		if len(res.Results) > limit {
+			res.Results = res.Results[:limit]
+		}
+	default:
+		err = fmt.Errorf("unknown action: %q", req.Action)
+	}
+	if err != nil {
+		res.Error = err.Error()
+		res.Results = nil
+		return res
+	}
+	res.OK = true
+	return res
+}
+
+// readNativeMessage reads a message prefixed by its length in native byte
+// order. It returns io.EOF if the browser closed the connection.
+func readNativeMessage(r io.Reader, v any) error {
+	var length uint32
+	err := binary.Read(r, binary.NativeEndian, &length)
+	if err != nil {
+		return err
+	}
+	if length > maxNativeMessageSize {
+		return fmt.Errorf("%w: %d bytes", errNativeMessageTooLarge, length)
+	}
+	message := make([]byte, length)
+	_, err = io.ReadFull(r, message)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(message, v)
+}
+
+func writeNativeMessage(w io.Writer, v any) error {
+	message, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(message) > maxNativeResponseSize {
+		return fmt.Errorf("%w: %d bytes", errNativeMessageTooLarge, len(message))
+	}
+	err = binary.Write(w, binary.NativeEndian, uint32(len(message)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message)
+	return err
+}
+
+// nativeHostManifest returns the manifest that registers this binary as a
+// native messaging host for the given browser ("chrome" or "firefox").
+func nativeHostManifest(browser string, extensionID string) ([]byte, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	manifest := map[string]any{
+		"name":        nativeHostName,
+		"description": "DocuStore",
+		"path":        executable,
+		"type":        "stdio",
+	}
+	switch browser {
+	case "chrome", "chromium":
+		manifest["allowed_origins"] = []string{fmt.Sprintf("chrome-extension://%s/", extensionID)}
+	case "firefox":
+		manifest["allowed_extensions"] = []string{extensionID}
+	default:
+		return nil, fmt.Errorf("unsupported browser: %s", browser)
+	}
+	return json.MarshalIndent(manifest, "", "  ")
+}
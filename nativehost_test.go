@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNativeMessageFraming(t *testing.T) {
+	var buffer bytes.Buffer
+	messages := []nativeRequest{
+		{ID: []byte(`1`), Action: "ping"},
+		{Action: "add", URL: "https://example.com/", HTML: "<p>" + strings.Repeat("é", 1000) + "</p>"},
+	}
+	for _, message := range messages {
+		if err := writeNativeMessage(&buffer, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var length uint32
+	binary.Read(bytes.NewReader(buffer.Bytes()), binary.NativeEndian, &length)
+	if length != uint32(len(`{"id":1,"action":"ping","url":"","html":"","query":"","limit":0}`)) {
+		t.Errorf("length prefix %d", length)
+	}
+	for _, expected := range messages {
+		var message nativeRequest
+		if err := readNativeMessage(&buffer, &message); err != nil {
+			t.Fatal(err)
+		}
+		if string(message.ID) != string(expected.ID) || message.Action != expected.Action || message.HTML != expected.HTML {
+			t.Errorf("read %+v, expected %+v", message, expected)
+		}
+	}
+	if err := readNativeMessage(&buffer, &nativeRequest{}); err != io.EOF {
+		t.Errorf("reading a closed input returned %v", err)
+	}
+
+	large := nativeResponse{Error: strings.Repeat("x", maxNativeResponseSize)}
+	if err := writeNativeMessage(io.Discard, large); !errors.Is(err, errNativeMessageTooLarge) {
+		t.Errorf("writing a message too large returned %v", err)
+	}
+
+	cases := []struct {
+		name  string
+		input []byte
+		err   error
+	}{
+		{"too large", binary.NativeEndian.AppendUint32(nil, maxNativeMessageSize+1), errNativeMessageTooLarge},
+		{"truncated length", []byte{1, 0}, io.ErrUnexpectedEOF},
+		{"truncated message", append(binary.NativeEndian.AppendUint32(nil, 20), `{"action":`...), io.ErrUnexpectedEOF},
+	}
+	for _, c := range cases {
+		err := readNativeMessage(bytes.NewReader(c.input), &nativeRequest{})
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: %v, expected %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestRunNativeHost(t *testing.T) {
+	engine := openTestEngine(t)
+	var input bytes.Buffer
+	requests := []nativeRequest{
+		{ID: []byte(`"a"`), Action: "ping"},
+		{ID: []byte(`"b"`), Action: "add", URL: "https://example.com/page", HTML: "<html><head><title>Saved page</title></head><body><p>rendered content</p></body></html>"},
+		{ID: []byte(`"c"`), Action: "search", Query: "rendered"},
+		{ID: []byte(`"d"`), Action: "add"},
+		{ID: []byte(`"e"`), Action: "dance"},
+	}
+	for _, req := range requests {
+		writeNativeMessage(&input, req)
+	}
+	var output bytes.Buffer
+	err := engine.RunNativeHost(context.Background(), &input, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []nativeResponse
+	for {
+		var res nativeResponse
+		err := readNativeMessage(&output, &res)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, res)
+	}
+	if len(responses) != len(requests) {
+		t.Fatalf("%d responses to %d requests", len(responses), len(requests))
+	}
+	for i, res := range responses {
+		if string(res.ID) != string(requests[i].ID) {
+			t.Errorf("response %d has ID %s", i, res.ID)
+		}
+	}
+	if !responses[0].OK || !responses[1].OK || responses[1].DocID == "" {
+		t.Errorf("ping and add: %+v, %+v", responses[0], responses[1])
+	}
+	if len(responses[2].Results) != 1 || responses[2].Results[0].DocID != responses[1].DocID {
+		t.Errorf("search: %+v", responses[2])
+	}
+	if responses[3].OK || responses[3].Error != "missing url" || responses[4].OK || responses[4].Error == "" {
+		t.Errorf("invalid requests: %+v, %+v", responses[3], responses[4])
+	}
+}
+
+func TestIsNativeMessagingLaunch(t *testing.T) {
+	manifest, _ := filepath.Abs(filepath.Join("hosts", nativeHostName+".json"))
+	cases := []struct {
+		args   []string
+		launch bool
+	}{
+		{[]string{"chrome-extension://abcdefghijklmnopabcdefghijklmnop/"}, true},
+		{[]string{"chrome-extension://abcdefghijklmnopabcdefghijklmnop/", "--parent-window=0"}, true},
+		{[]string{manifest, "docustore@example.com"}, true},
+		{[]string{manifest, "{12345678-abcd-ef01-2345-6789abcdef01}"}, true},
+		{nil, false},
+		{[]string{"query", "spark"}, false},
+		{[]string{"chrome-extension://short/"}, false},
+		{[]string{"chrome-extension://abcdefghijklmnopabcdefghijklmnop/", "query"}, false},
+		{[]string{"import", "archive.json"}, false},
+		{[]string{"add", "notes.json"}, false},
+		{[]string{"config.json", "docustore@example.com"}, false},
+		{[]string{filepath.Join(filepath.Dir(manifest), "other.json"), "docustore@example.com"}, false},
+		{[]string{manifest, "-json"}, false},
+		{[]string{manifest, "docustore@example.com", "extra"}, false},
+	}
+	for _, c := range cases {
+		if launch := isNativeMessagingLaunch(c.args); launch != c.launch {
+			t.Errorf("%q: %v, expected %v", c.args, launch, c.launch)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"encoding/gob"
-	"log"
+	"fmt"
 	"os"
 	"sync"
 )
@@ -21,12 +21,13 @@ func SaveStruct(path string, v interface{}) error {
 	enc := gob.NewEncoder(f)
 	err = enc.Encode(v)
 	if err != nil {
-		log.Fatal("encode error:", err)
+		return fmt.Errorf("encoding %s: %w", path, err)
 	}
-	return err
+	return f.Close()
 }
 
-// LoadStruct loads the file at path into v.
+// LoadStruct loads the file at path into v. Files that cannot be decoded
+// return ErrCorrupted.
 func LoadStruct(path string, v interface{}) error {
 	lock.Lock()
 	defer lock.Unlock()
@@ -36,5 +37,9 @@ func LoadStruct(path string, v interface{}) error {
 	}
 	defer f.Close()
 	dec := gob.NewDecoder(f)
-	return dec.Decode(v)
+	err = dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrCorrupted, path, err)
+	}
+	return nil
 }
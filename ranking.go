@@ -0,0 +1,199 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sort"
+
+	"DocuStore/search"
+)
+
+// Search returns the k documents most similar to the query term
+// frequencies, ranked by TF-IDF cosine similarity like the TF-IDF searcher,
+// from the weights stored in the index. Documents that cannot reach the k
+// best scores are skipped with the MaxScore algorithm.
+//
+// Document norms are computed with the document frequencies of the time
+// their segment was written, and refreshed when segments are merged.
+func (s *SegmentedIndex) Search(ctx context.Context, termFreqs map[string]float64, k int) ([]*search.SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k <= 0 {
+		return nil, nil
+	}
+	weights := make(map[string]float64, len(termFreqs))
+	var queryNorm float64
+	for token, freq := range termFreqs {
+		// tokens missing from the collection weigh as much as in the
+		// TF-IDF searcher
+		factor := 1.0
+		if s.counter.DocCounts[token] > 0 {
+			factor = s.idf(token)
+		}
+		weights[token] = freq * factor * factor
+		queryNorm += freq * freq * factor * factor
+	}
+
+	top := &scoredDocs{}
+	for _, seg := range s.segments {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		s.searchSegment(seg, weights, k, top)
+	}
+
+	results := make([]*search.SearchResult, len(top.docs))
+	sort.Slice(top.docs, func(i, j int) bool {
+		return top.docs[i].score > top.docs[j].score
+	})
+	for i, scored := range top.docs {
+		doc := scored.seg.Docs.Docs[scored.num]
+		results[i] = &search.SearchResult{
+			DocID:      doc.DocID,
+			Title:      doc.Title,
+			Identifier: doc.Identifier,
+			Type:       doc.Type.String(),
+			Score:      math.Sqrt(scored.score / math.Sqrt(queryNorm+1e-8)),
+		}
+	}
+	return results, nil
+}
+
+type queryList struct {
+	cursor postingCursor
+	weight float64
+	// highest contribution of the list to a score
+	bound float64
+}
+
+// searchSegment adds the best documents of a segment to top, keeping the k
+// best overall. Scores are dot products with the query weights divided by
+// the document norms.
+func (s *SegmentedIndex) searchSegment(seg *segment, weights map[string]float64, k int, top *scoredDocs) {
+	lists := make([]*queryList, 0, len(weights))
+	for token, weight := range weights {
+		list, ok := seg.Docs.Lists[token]
+		if !ok {
+			continue
+		}
+		q := &queryList{cursor: postingCursor{data: list.Data}, weight: weight, bound: weight * list.MaxImpact}
+		if q.cursor.next() {
+			lists = append(lists, q)
+		}
+	}
+	// bounds[i] is the highest score of a document only found in lists[:i+1]
+	sort.Slice(lists, func(i, j int) bool {
+		return lists[i].bound < lists[j].bound
+	})
+	bounds := make([]float64, len(lists))
+	var sum float64
+	for i, list := range lists {
+		sum += list.bound
+		bounds[i] = sum
+	}
+
+	for {
+		threshold := top.threshold(k)
+		// lists whose documents cannot enter the top by themselves are only
+		// used to complete the scores of documents of the others
+		essential := 0
+		for essential < len(lists) && bounds[essential] <= threshold {
+			essential++
+		}
+		if essential == len(lists) {
+			return
+		}
+		var num uint32
+		found := false
+		for _, list := range lists[essential:] {
+			if !list.cursor.done && (!found || list.cursor.num < num) {
+				num = list.cursor.num
+				found = true
+			}
+		}
+		if !found {
+			return
+		}
+
+		var score float64
+		for _, list := range lists[essential:] {
+			if !list.cursor.done && list.cursor.num == num {
+				score += list.weight * seg.Docs.impact(num, list.cursor.freq)
+				list.cursor.next()
+			}
+		}
+		for i := essential - 1; i >= 0; i-- {
+			if score+bounds[i] <= threshold {
+				break
+			}
+			list := lists[i]
+			list.cursor.seek(num)
+			if !list.cursor.done && list.cursor.num == num {
+				score += list.weight * seg.Docs.impact(num, list.cursor.freq)
+			}
+		}
+		if score > threshold && s.owner[seg.Docs.Docs[num].DocID] == seg {
+			top.add(scoredDoc{seg, num, score}, k)
+		}
+	}
+}
+
+type scoredDoc struct {
+	seg   *segment
+	num   uint32
+	score float64
+}
+
+// scoredDocs is a min-heap of the best documents found so far.
+type scoredDocs struct {
+	docs []scoredDoc
+}
+
+func (h *scoredDocs) Len() int           { return len(h.docs) }
+func (h *scoredDocs) Less(i, j int) bool { return h.docs[i].score < h.docs[j].score }
+func (h *scoredDocs) Swap(i, j int)      { h.docs[i], h.docs[j] = h.docs[j], h.docs[i] }
+func (h *scoredDocs) Push(x any)         { h.docs = append(h.docs, x.(scoredDoc)) }
+func (h *scoredDocs) Pop() any {
+	last := h.docs[len(h.docs)-1]
+	h.docs = h.docs[:len(h.docs)-1]
+	return last
+}
+
+// threshold is the score to beat to enter the k best documents.
+func (h *scoredDocs) threshold(k int) float64 {
+	if len(h.docs) < k {
+		return 0
+	}
+	return h.docs[0].score
+}
+
+func (h *scoredDocs) add(doc scoredDoc, k int) {
+	heap.Push(h, doc)
+	if len(h.docs) > k {
+		heap.Pop(h)
+	}
+}
+
+// Summaries returns the titles, identifiers and types of the documents
+// stored in the index, without their term frequencies. Documents missing
+// from the index are left out.
+func (s *SegmentedIndex) Summaries(docIDs ...string) []*search.DocSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*search.DocSummary, 0, len(docIDs))
+	for _, docID := range docIDs {
+		seg, ok := s.owner[docID]
+		if !ok {
+			continue
+		}
+		doc := seg.Docs.Docs[seg.Docs.DocNums[docID]]
+		out = append(out, &search.DocSummary{
+			DocID:      doc.DocID,
+			Title:      doc.Title,
+			Identifier: doc.Identifier,
+			Type:       doc.Type,
+		})
+	}
+	return out
+}
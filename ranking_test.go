@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"DocuStore/search"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+func loadWords(t testing.TB) []string {
+	file, err := os.Open("assets/words.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		words = append(words, scanner.Text())
+	}
+	return words
+}
+
+// randomDocs returns documents of words drawn with a skewed distribution,
+// so that tokens have varied document frequencies.
+func randomDocs(rng *rand.Rand, words []string, nDocs int, nWords int) []*search.DocSummary {
+	docs := make([]*search.DocSummary, nDocs)
+	for i := range docs {
+		text := make([]string, nWords)
+		for j := range text {
+			text[j] = words[int(math.Pow(rng.Float64(), 3)*1000)]
+		}
+		title := fmt.Sprintf("doc %d", i)
+		docs[i] = search.NewFieldDocSummary(map[search.Field]string{
+			search.TitleField: title + " " + text[0],
+			search.BodyField:  strings.Join(text, " "),
+		}, title, title, search.Text)
+	}
+	return docs
+}
+
+func randomQuery(rng *rand.Rand, words []string, nWords int) string {
+	query := make([]string, nWords)
+	for i := range query {
+		query[i] = words[rng.Intn(1000)]
+	}
+	return strings.Join(query, " ")
+}
+
+func TestSearchMatchesTFIDF(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := loadWords(t)
+	docs := randomDocs(rng, words, 300, 50)
+	index, _ := OpenSegmentedIndex(t.TempDir(), search.DefaultFieldBoosts, logger.NewDefaultLogger())
+	all := NewInvertedIndex()
+	for _, doc := range docs {
+		all.InsertDoc(doc, search.DefaultFieldBoosts, 1)
+	}
+	if err := index.Reset(all, 1); err != nil {
+		t.Fatal(err)
+	}
+	searcher, err := search.NewTFIDFSearcher(index.Counter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		query := randomQuery(rng, words, 1+i%4)
+		results, _ := index.Search(context.Background(), search.TermFrequencies(query), 10)
+		expected := searcher.Search(query, docs...)
+		for j, result := range results {
+			if math.Abs(result.Score-expected[j].Score) > 1e-3 {
+				t.Fatalf("%q: result %d scores %.4f, expected %.4f", query, j, result.Score, expected[j].Score)
+			}
+		}
+	}
+}
+
+func TestSearchTopK(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	words := loadWords(t)
+	index, _ := OpenSegmentedIndex(t.TempDir(), search.DefaultFieldBoosts, logger.NewDefaultLogger())
+	docs := randomDocs(rng, words, 200, 30)
+	for i, doc := range docs {
+		if err := index.InsertDoc(doc, int64(i)); err != nil {
+			t.Fatal(err)
+		}
+		if i%5 == 4 {
+			if err := index.RemoveDoc(docs[i-2], int64(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	index.Close()
+	for i := 0; i < 50; i++ {
+		termFreqs := search.TermFrequencies(randomQuery(rng, words, 1+i%6))
+		all, _ := index.Search(context.Background(), termFreqs, len(docs))
+		top, _ := index.Search(context.Background(), termFreqs, 5)
+		if len(top) != min(5, len(all)) {
+			t.Fatalf("%d results, expected %d", len(top), min(5, len(all)))
+		}
+		for j, result := range top {
+			if math.Abs(result.Score-all[j].Score) > 1e-9 {
+				t.Errorf("result %d scores %f, expected %f", j, result.Score, all[j].Score)
+			}
+		}
+		for _, result := range all {
+			if result.DocID == docs[2].DocID {
+				t.Errorf("removed document found")
+			}
+		}
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	rng := rand.New(rand.NewSource(3))
+	words := loadWords(b)
+	for _, nDocs := range []int{1000, 10000} {
+		docs := randomDocs(rng, words, nDocs, 100)
+		index, _ := OpenSegmentedIndex(b.TempDir(), search.DefaultFieldBoosts, logger.NewDefaultLogger())
+		all := NewInvertedIndex()
+		for _, doc := range docs {
+			all.InsertDoc(doc, search.DefaultFieldBoosts, 1)
+		}
+		if err := index.Reset(all, 1); err != nil {
+			b.Fatal(err)
+		}
+		searcher, err := search.NewTFIDFSearcher(index.Counter())
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, lenQuery := range []int{1, 10} {
+			query := randomQuery(rng, words, lenQuery)
+			termFreqs := search.TermFrequencies(query)
+			b.Run(fmt.Sprintf("top 10 of %d docs for %d query words", nDocs, lenQuery), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, _ = index.Search(context.Background(), termFreqs, 10)
+				}
+			})
+			b.Run(fmt.Sprintf("searcher over %d docs for %d query words", nDocs, lenQuery), func(b *testing.B) {
+				candidates := index.Summaries(index.SearchTokens(search.Tokenize(query))...)
+				byID := make(map[string]*search.DocSummary, len(docs))
+				for _, doc := range docs {
+					byID[doc.DocID] = doc
+				}
+				for j, doc := range candidates {
+					candidates[j] = byID[doc.DocID]
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					_ = searcher.Search(query, candidates...)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+// resources larger than this are left as links to the live web
+const maxResourceSize = 5 << 20
+
+// ArchivePage turns the raw HTML of a page served from pageURL into a view
+// that can be opened from disk. Relative links keep pointing to the original
+// site and scripts are removed. If inline is true, stylesheets and images are
+// embedded so that the page renders without network access, otherwise the
+// network is not accessed.
+func ArchivePage(ctx context.Context, body []byte, pageURL string, inline bool, opts ScrapeOptions, log logger.Logger) ([]byte, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+
+	doc.Find("script, noscript").Remove()
+	if inline {
+		opts = opts.withDefaults()
+		inlineStylesheets(ctx, doc, base, opts, log)
+		inlineImages(ctx, doc, base, opts, log)
+	}
+
+	doc.Find("base").Remove()
+	head := doc.Find("head")
+	head.PrependHtml(fmt.Sprintf(`<base href="%s">`, htmlAttrEscaper.Replace(base.String())))
+	head.PrependHtml(`<meta charset="utf-8">`)
+
+	out, err := doc.Html()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+var htmlAttrEscaper = strings.NewReplacer(`&`, "&amp;", `"`, "&quot;", `<`, "&lt;", `>`, "&gt;")
+
+func inlineStylesheets(ctx context.Context, doc *goquery.Document, base *url.URL, opts ScrapeOptions, log logger.Logger) {
+	doc.Find(`link[rel~="stylesheet"][href]`).Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		css, _, err := fetchResource(ctx, base, href, opts)
+		if err != nil {
+			log.Debug(fmt.Sprintf("not inlining stylesheet %s: %s", href, err))
+			return
+		}
+		cssURL, _ := base.Parse(strings.TrimSpace(href))
+		text := absoluteCSSURLs(string(css), cssURL)
+		s.ReplaceWithHtml("<style>" + strings.ReplaceAll(text, "</style", `<\/style`) + "</style>")
+	})
+}
+
+var cssURLRegex = regexp.MustCompile(`url\(\s*['"]?([^'")]+)['"]?\s*\)`)
+
+// absoluteCSSURLs rewrites the url() references of a stylesheet, which are
+// relative to the stylesheet rather than to the page it is inlined into.
+func absoluteCSSURLs(css string, cssURL *url.URL) string {
+	return cssURLRegex.ReplaceAllStringFunc(css, func(match string) string {
+		ref := cssURLRegex.FindStringSubmatch(match)[1]
+		if strings.HasPrefix(ref, "data:") {
+			return match
+		}
+		u, err := cssURL.Parse(ref)
+		if err != nil {
+			return match
+		}
+		return fmt.Sprintf(`url("%s")`, u.String())
+	})
+}
+
+func inlineImages(ctx context.Context, doc *goquery.Document, base *url.URL, opts ScrapeOptions, log logger.Logger) {
+	doc.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		if strings.HasPrefix(src, "data:") {
+			return
+		}
+		data, contentType, err := fetchResource(ctx, base, src, opts)
+		if err != nil {
+			log.Debug(fmt.Sprintf("not inlining image %s: %s", src, err))
+			return
+		}
+		if contentType == "" || !strings.HasPrefix(contentType, "image/") {
+			contentType = http.DetectContentType(data)
+		}
+		s.SetAttr("src", "data:"+contentType+";base64,"+base64.StdEncoding.EncodeToString(data))
+		s.RemoveAttr("srcset")
+	})
+}
+
+func fetchResource(ctx context.Context, base *url.URL, ref string, opts ScrapeOptions) ([]byte, string, error) {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, "", err
+	}
+	response, err := opts.get(ctx, u.String())
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status: %s", response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxResourceSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxResourceSize {
+		return nil, "", fmt.Errorf("larger than %d bytes", maxResourceSize)
+	}
+	return data, response.Header.Get("Content-Type"), nil
+}
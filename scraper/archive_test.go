@@ -0,0 +1,86 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+func TestAbsoluteCSSURLs(t *testing.T) {
+	cssURL, _ := url.Parse("https://example.com/static/css/site.css")
+	cases := []struct {
+		css      string
+		expected string
+	}{
+		{`body { background: url(bg.png) }`, `body { background: url("https://example.com/static/css/bg.png") }`},
+		{`a { b: url( '../img/a.svg' ) }`, `a { b: url("https://example.com/static/img/a.svg") }`},
+		{`@font-face { src: url("/fonts/f.woff2") }`, `@font-face { src: url("https://example.com/fonts/f.woff2") }`},
+		{`i { b: url(https://cdn.example.org/x.png) }`, `i { b: url("https://cdn.example.org/x.png") }`},
+		{`i { b: url(data:image/png;base64,AAAA) }`, `i { b: url(data:image/png;base64,AAAA) }`},
+		{`p { color: red }`, `p { color: red }`},
+	}
+	for _, c := range cases {
+		if out := absoluteCSSURLs(c.css, cssURL); out != c.expected {
+			t.Errorf("%s: %s, expected %s", c.css, out, c.expected)
+		}
+	}
+}
+
+func TestArchivePage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/css/site.css":
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, "body { background: url(../img/bg.png) }")
+		case "/img/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNGDATA")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	page := `<html><head><title>Page</title><link rel="stylesheet" href="/css/site.css"><script>alert(1)</script></head>` +
+		`<body><img src="img/logo.png" srcset="img/logo2x.png 2x"><img src="img/missing.png"><a href="other">link</a></body></html>`
+	ctx := context.Background()
+	log := logger.NewDefaultLogger()
+
+	view, err := ArchivePage(ctx, []byte(page), server.URL+"/", false, DefaultScrapeOptions, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(view)
+	for _, want := range []string{`<meta charset="utf-8"/>`, `<base href="` + server.URL + `/"/>`, `href="/css/site.css"`, `src="img/logo.png"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("view lacks %s: %s", want, html)
+		}
+	}
+	if strings.Contains(html, "alert") {
+		t.Errorf("view keeps scripts: %s", html)
+	}
+
+	view, err = ArchivePage(ctx, []byte(page), server.URL+"/", true, DefaultScrapeOptions, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html = string(view)
+	for _, want := range []string{
+		`<style>body { background: url("` + server.URL + `/img/bg.png") }</style>`,
+		`src="data:image/png;base64,UE5HREFUQQ=="`,
+		`src="img/missing.png"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("inlined view lacks %s: %s", want, html)
+		}
+	}
+	if strings.Contains(html, "srcset") || strings.Contains(html, "stylesheet") {
+		t.Errorf("inlined view keeps links to resources: %s", html)
+	}
+}
@@ -0,0 +1,307 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+// maximum number of nested sitemap indexes to follow
+const maxSitemapNesting = 3
+
+// CrawlOptions limits how far a crawl may go from its starting URL.
+type CrawlOptions struct {
+	MaxDepth   int           // links followed from the start page, 0 means only the start page
+	MaxPages   int           // maximum number of pages visited, 0 means no limit
+	UseSitemap bool          // seed the crawl from sitemap.xml instead of following links
+	Delay      time.Duration // minimum delay between requests
+	Scrape     ScrapeOptions
+}
+
+// CrawledPage is a single page visited during a crawl.
+type CrawledPage struct {
+	URL   string
+	Depth int
+	Data  *ScrapeData
+}
+
+type crawlItem struct {
+	url   *url.URL
+	depth int
+}
+
+type crawler struct {
+	opts   CrawlOptions
+	log    logger.Logger
+	root   *url.URL
+	scope  string
+	robots *robotsRules
+	seen   map[string]bool
+	queue  []crawlItem
+	last   time.Time
+}
+
+// Crawl visits pages reachable from startURL that share its host and path
+// prefix, calling visit for each page. robots.txt is honored and each URL
+// is visited at most once. An error returned by visit, or the cancellation of
+// ctx, stops the crawl.
+func Crawl(ctx context.Context, startURL string, opts CrawlOptions, log logger.Logger, visit func(*CrawledPage) error) error {
+	root, err := url.Parse(strings.TrimSpace(startURL))
+	if err != nil {
+		return err
+	}
+	if root.Scheme != "http" && root.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme: %s", root.Scheme)
+	}
+
+	opts.Scrape = opts.Scrape.withDefaults()
+	c := &crawler{
+		opts:  opts,
+		log:   log,
+		root:  root,
+		scope: crawlScope(root),
+		seen:  make(map[string]bool),
+	}
+	c.robots = c.fetchRobots(ctx)
+	if c.robots.crawlDelay > c.opts.Delay {
+		c.opts.Delay = c.robots.crawlDelay
+	}
+
+	if opts.UseSitemap {
+		for _, loc := range c.sitemapURLs(ctx) {
+			c.enqueue(loc, 0)
+		}
+	}
+	c.enqueue(root, 0)
+
+	visited := 0
+	for len(c.queue) > 0 {
+		if opts.MaxPages > 0 && visited >= opts.MaxPages {
+			break
+		}
+		item := c.queue[0]
+		c.queue = c.queue[1:]
+
+		body, pageURL, err := c.get(ctx, item.url.String(), "html")
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Warning(fmt.Sprintf("skipping %s: %s", item.url, err))
+			continue
+		}
+		if !c.inScope(pageURL) {
+			continue
+		}
+		visited++
+		// redirects and canonical links lead to pages that need no visit
+		c.markSeen(pageURL)
+
+		data, err := parseHTML(body, pageURL, opts.Scrape.TextTags, log)
+		if err != nil {
+			log.Warning(fmt.Sprintf("skipping %s: %s", item.url, err))
+			continue
+		}
+		if data.Canonical != "" {
+			if canonical, err := url.Parse(data.Canonical); err == nil {
+				c.markSeen(canonical)
+			}
+		}
+		err = visit(&CrawledPage{URL: pageURL.String(), Depth: item.depth, Data: data})
+		if err != nil {
+			return err
+		}
+
+		if !opts.UseSitemap && item.depth < opts.MaxDepth {
+			for _, link := range extractLinks(body, pageURL) {
+				c.enqueue(link, item.depth+1)
+			}
+		}
+	}
+	return nil
+}
+
+// crawlScope is the directory of the start URL, pages outside of it are not
+// crawled.
+func crawlScope(root *url.URL) string {
+	if strings.HasSuffix(root.Path, "/") {
+		return root.Path
+	}
+	dir := path.Dir(root.Path)
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return dir
+}
+
+func (c *crawler) inScope(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if !strings.EqualFold(u.Host, c.root.Host) {
+		return false
+	}
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	return strings.HasPrefix(p, c.scope) || p+"/" == c.scope
+}
+
+func (c *crawler) enqueue(u *url.URL, depth int) {
+	if !c.inScope(u) {
+		return
+	}
+	if c.markSeen(u) {
+		return
+	}
+	if !c.robots.allowed(u.RequestURI()) {
+		c.log.Debug(fmt.Sprintf("robots.txt disallows %s", u))
+		return
+	}
+	page := *u
+	page.Fragment = ""
+	page.RawFragment = ""
+	c.queue = append(c.queue, crawlItem{url: &page, depth: depth})
+}
+
+// markSeen records u by its normalized form and reports whether it had
+// already been seen.
+func (c *crawler) markSeen(u *url.URL) bool {
+	key := normalizeURL(u).String()
+	if c.seen[key] {
+		return true
+	}
+	c.seen[key] = true
+	return false
+}
+
+// get fetches rawURL, waiting for the configured delay, and returns the body
+// and the URL it was served from after redirects. If contentType is not
+// empty, responses whose Content-Type does not contain it are rejected.
+func (c *crawler) get(ctx context.Context, rawURL string, contentType string) ([]byte, *url.URL, error) {
+	if wait := c.opts.Delay - time.Since(c.last); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	c.last = time.Now()
+
+	response, err := c.opts.Scrape.get(ctx, rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, nil, &FetchError{URL: rawURL, StatusCode: response.StatusCode, Status: response.Status}
+	}
+	if contentType != "" && !strings.Contains(response.Header.Get("Content-Type"), contentType) {
+		return nil, nil, fmt.Errorf("unexpected content type: %s", response.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(response.Body)
+	return body, response.Request.URL, err
+}
+
+// fetchRobots reads the robots.txt file of the crawled site. As in RFC 9309,
+// a missing file allows everything, but a server or network error disallows
+// everything, since the site may not want to be crawled.
+func (c *crawler) fetchRobots(ctx context.Context) *robotsRules {
+	robotsURL := &url.URL{Scheme: c.root.Scheme, Host: c.root.Host, Path: "/robots.txt"}
+	body, _, err := c.get(ctx, robotsURL.String(), "")
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) && fetchErr.StatusCode >= 400 && fetchErr.StatusCode < 500 {
+		c.log.Debug(fmt.Sprintf("no robots.txt: %s", err))
+		return &robotsRules{}
+	}
+	if err != nil {
+		c.log.Warning(fmt.Sprintf("robots.txt unavailable, not crawling: %s", err))
+		return &robotsRules{disallow: []string{"/"}}
+	}
+	return parseRobots(bytes.NewReader(body), c.opts.Scrape.UserAgent)
+}
+
+type sitemapDoc struct {
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// sitemapURLs lists the page URLs in the sitemaps declared in robots.txt,
+// or in /sitemap.xml if there are none.
+func (c *crawler) sitemapURLs(ctx context.Context) []*url.URL {
+	sitemaps := c.robots.sitemaps
+	if len(sitemaps) == 0 {
+		sitemapURL := &url.URL{Scheme: c.root.Scheme, Host: c.root.Host, Path: "/sitemap.xml"}
+		sitemaps = []string{sitemapURL.String()}
+	}
+	var out []*url.URL
+	for _, sitemap := range sitemaps {
+		out = append(out, c.readSitemap(ctx, sitemap, 0)...)
+	}
+	return out
+}
+
+func (c *crawler) readSitemap(ctx context.Context, sitemapURL string, nesting int) []*url.URL {
+	body, _, err := c.get(ctx, sitemapURL, "")
+	if err != nil {
+		c.log.Warning(fmt.Sprintf("error reading sitemap %s: %s", sitemapURL, err))
+		return nil
+	}
+	var doc sitemapDoc
+	err = xml.Unmarshal(body, &doc)
+	if err != nil {
+		c.log.Warning(fmt.Sprintf("error parsing sitemap %s: %s", sitemapURL, err))
+		return nil
+	}
+
+	var out []*url.URL
+	for _, loc := range doc.URLs {
+		u, err := url.Parse(strings.TrimSpace(loc))
+		if err == nil {
+			out = append(out, u)
+		}
+	}
+	if nesting < maxSitemapNesting {
+		for _, loc := range doc.Sitemaps {
+			out = append(out, c.readSitemap(ctx, strings.TrimSpace(loc), nesting+1)...)
+		}
+	}
+	return out
+}
+
+// extractLinks returns the absolute URLs of all anchors in body.
+func extractLinks(body []byte, base *url.URL) []*url.URL {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+	var out []*url.URL
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		if rel, _ := s.Attr("rel"); strings.Contains(rel, "nofollow") {
+			return
+		}
+		href, _ := s.Attr("href")
+		u, err := base.Parse(strings.TrimSpace(href))
+		if err == nil {
+			out = append(out, u)
+		}
+	})
+	return out
+}
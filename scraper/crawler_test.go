@@ -0,0 +1,100 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+func crawlTestSite(robotsStatus int) *httptest.Server {
+	pages := map[string]string{
+		"/docs/":          `<a href="a">A</a> <a href="/docs/b#part">B</a> <a href="/docs/private/x">X</a> <a href="/blog">Blog</a> <a href="https://example.com/docs/">Elsewhere</a> <a href="search?q=kestrel">Search</a>`,
+		"/docs/a":         `<a href="/docs/">Back</a> <a href="/docs/c">C</a>`,
+		"/docs/b":         `<a href="/docs/a">A</a>`,
+		"/docs/c":         `<p>deep page</p>`,
+		"/docs/search":    `<p>search results</p>`,
+		"/docs/private/x": `<p>private</p>`,
+		"/blog":           `<p>out of scope</p>`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(robotsStatus)
+			fmt.Fprint(w, "User-agent: *\nDisallow: /docs/private/\nDisallow: /docs/search?q=\n")
+			return
+		}
+		if r.URL.Path == "/sitemap.xml" {
+			fmt.Fprintf(w, "<urlset><url><loc>http://%[1]s/docs/</loc></url><url><loc>http://%[1]s/docs/b</loc></url></urlset>", r.Host)
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body>%s</body></html>", r.URL.Path, page)
+	}))
+}
+
+func crawlPaths(t *testing.T, server *httptest.Server, opts CrawlOptions) []string {
+	t.Helper()
+	var paths []string
+	err := Crawl(context.Background(), server.URL+"/docs/", opts, logger.NewDefaultLogger(), func(page *CrawledPage) error {
+		paths = append(paths, page.URL[len(server.URL):])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestCrawl(t *testing.T) {
+	server := crawlTestSite(http.StatusOK)
+	defer server.Close()
+
+	cases := []struct {
+		name  string
+		opts  CrawlOptions
+		paths []string
+	}{
+		{"start page", CrawlOptions{}, []string{"/docs/"}},
+		{"one link", CrawlOptions{MaxDepth: 1}, []string{"/docs/", "/docs/a", "/docs/b"}},
+		{"two links", CrawlOptions{MaxDepth: 2}, []string{"/docs/", "/docs/a", "/docs/b", "/docs/c"}},
+		{"page limit", CrawlOptions{MaxDepth: 2, MaxPages: 2}, []string{"/docs/", "/docs/a"}},
+		// the links of the pages in the sitemap are not followed
+		{"sitemap", CrawlOptions{MaxDepth: 2, UseSitemap: true}, []string{"/docs/", "/docs/b"}},
+	}
+	for _, c := range cases {
+		paths := crawlPaths(t, server, c.opts)
+		if !slices.Equal(paths, c.paths) {
+			t.Errorf("%s: visited %q, expected %q", c.name, paths, c.paths)
+		}
+	}
+}
+
+func TestCrawlRobotsUnavailable(t *testing.T) {
+	cases := []struct {
+		status int
+		paths  []string
+	}{
+		// a missing robots.txt allows everything
+		{http.StatusNotFound, []string{"/docs/", "/docs/a", "/docs/b", "/docs/private/x", "/docs/search?q=kestrel"}},
+		{http.StatusInternalServerError, nil},
+		{http.StatusServiceUnavailable, nil},
+	}
+	for _, c := range cases {
+		server := crawlTestSite(c.status)
+		paths := crawlPaths(t, server, CrawlOptions{MaxDepth: 1})
+		server.Close()
+		if !slices.Equal(paths, c.paths) {
+			t.Errorf("robots.txt status %d: visited %q, expected %q", c.status, paths, c.paths)
+		}
+	}
+}
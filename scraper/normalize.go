@@ -0,0 +1,115 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// query parameters that only track where a visitor came from
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"ref_src": true,
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL returns the canonical form of rawURL, so that trivially
+// different URLs of the same page map to the same document.
+func NormalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("not an absolute URL: %s", rawURL)
+	}
+	return normalizeURL(u).String(), nil
+}
+
+// normalizeURL returns a normalized copy of u: lowercase scheme and host,
+// no default port, fragment, tracking parameters or trailing slash, and
+// sorted query parameters.
+func normalizeURL(u *url.URL) *url.URL {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if port := n.Port(); port != "" && defaultPorts[n.Scheme] == port {
+		n.Host = strings.TrimSuffix(n.Host, ":"+port)
+	}
+	n.Fragment = ""
+	n.RawFragment = ""
+
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	if n.Path != "/" {
+		cleaned := path.Clean(n.Path)
+		if cleaned != n.Path {
+			n.Path = cleaned
+			n.RawPath = ""
+		}
+	}
+
+	query := n.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			query.Del(key)
+		}
+	}
+	n.RawQuery = encodeSortedQuery(query)
+	n.ForceQuery = false
+	return &n
+}
+
+func encodeSortedQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(key))
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(value))
+		}
+	}
+	return b.String()
+}
+
+// URLWords returns the words of the host and path of a URL, which are
+// otherwise glued together into a single token.
+func URLWords(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	words := strings.FieldsFunc(u.Hostname()+" "+u.Path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
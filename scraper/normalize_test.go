@@ -0,0 +1,70 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	cases := []struct {
+		url        string
+		normalized string
+	}{
+		{"https://example.com", "https://example.com/"},
+		{"HTTPS://Example.COM/Docs", "https://example.com/Docs"},
+		{"https://example.com:443/page", "https://example.com/page"},
+		{"http://example.com:80/page", "http://example.com/page"},
+		{"http://example.com:8080/page", "http://example.com:8080/page"},
+		{"https://example.com:80/page", "https://example.com:80/page"},
+		{"https://example.com/docs/", "https://example.com/docs"},
+		{"https://example.com/a/./b/../c", "https://example.com/a/c"},
+		{"https://example.com/page#section", "https://example.com/page"},
+		{"https://example.com/page?", "https://example.com/page"},
+		{"https://example.com/page?utm_source=news&UTM_Medium=mail&fbclid=x&gclid=y", "https://example.com/page"},
+		{"https://example.com/page?b=2&id=7&a=1&_ga=3", "https://example.com/page?a=1&b=2&id=7"},
+		{"https://example.com/search?q=a+b&q=c", "https://example.com/search?q=a+b&q=c"},
+		{"  https://example.com/page  ", "https://example.com/page"},
+	}
+	for _, c := range cases {
+		normalized, err := NormalizeURL(c.url)
+		if err != nil {
+			t.Errorf("%s: %s", c.url, err)
+			continue
+		}
+		if normalized != c.normalized {
+			t.Errorf("%s: normalized to %s, expected %s", c.url, normalized, c.normalized)
+		}
+	}
+
+	for _, url := range []string{"example.com/page", "/page", "mailto:someone@example.com"} {
+		if _, err := NormalizeURL(url); err == nil {
+			t.Errorf("%s: normalized a relative URL", url)
+		}
+	}
+}
+
+func TestCanonicalLink(t *testing.T) {
+	cases := []struct {
+		name      string
+		link      string
+		canonical string
+	}{
+		{"absolute", `<link rel="canonical" href="https://example.com/guide/?utm_source=feed">`, "https://example.com/guide"},
+		{"relative", `<link rel="canonical" href="../guide#intro">`, "https://example.com/guide"},
+		{"several rels", `<link rel="alternate canonical" href="/guide">`, "https://example.com/guide"},
+		{"other host", `<link rel="canonical" href="https://other.com/guide">`, ""},
+		{"none", `<link rel="alternate" href="/feed.xml">`, ""},
+	}
+	for _, c := range cases {
+		html := "<html><head><title>Guide</title>" + c.link + "</head><body><p>text</p></body></html>"
+		data, err := ExtractFromHTML(strings.NewReader(html), "https://example.com/docs/page?ref=nav", DefaultScrapeOptions, logger.NewDefaultLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Canonical != c.canonical {
+			t.Errorf("%s: canonical %q, expected %q", c.name, data.Canonical, c.canonical)
+		}
+	}
+}
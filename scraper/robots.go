@@ -0,0 +1,135 @@
+package scraper
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules holds the subset of a robots.txt file that applies to us.
+type robotsRules struct {
+	allow      []string
+	disallow   []string
+	crawlDelay time.Duration
+	sitemaps   []string
+}
+
+// parseRobots reads a robots.txt file and keeps the rules of the group that
+// best matches userAgent, falling back to the wildcard group.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	userAgent = strings.ToLower(userAgent)
+	specific := &robotsRules{}
+	wildcard := &robotsRules{}
+	var sitemaps []string
+	var current []*robotsRules
+	inRules := false
+	foundSpecific := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// a user-agent line after rules starts a new group
+			if inRules {
+				current = nil
+				inRules = false
+			}
+			agent := strings.ToLower(value)
+			if agent == "*" {
+				current = append(current, wildcard)
+			} else if agent != "" && strings.Contains(userAgent, agent) {
+				foundSpecific = true
+				current = append(current, specific)
+			}
+		case "allow", "disallow", "crawl-delay":
+			inRules = true
+			for _, rules := range current {
+				switch key {
+				case "allow":
+					if value != "" {
+						rules.allow = append(rules.allow, value)
+					}
+				case "disallow":
+					if value != "" {
+						rules.disallow = append(rules.disallow, value)
+					}
+				case "crawl-delay":
+					if secs, err := strconv.ParseFloat(value, 64); err == nil {
+						rules.crawlDelay = time.Duration(secs * float64(time.Second))
+					}
+				}
+			}
+		case "sitemap":
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+
+	rules := wildcard
+	if foundSpecific {
+		rules = specific
+	}
+	rules.sitemaps = sitemaps
+	return rules
+}
+
+// allowed reports whether path may be fetched. The longest matching rule
+// wins and allow rules win ties, as in the robots exclusion standard.
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	best := -1
+	allowed := true
+	for _, rule := range r.disallow {
+		if n := robotsMatch(rule, path); n > best {
+			best = n
+			allowed = false
+		}
+	}
+	for _, rule := range r.allow {
+		if n := robotsMatch(rule, path); n >= best && n >= 0 {
+			best = n
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// robotsMatch returns the length of rule if it matches path, -1 otherwise.
+// The '*' wildcard and the '$' end anchor are supported.
+func robotsMatch(rule string, path string) int {
+	anchored := strings.HasSuffix(rule, "$")
+	pattern := strings.TrimSuffix(rule, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return -1
+	}
+	pos := len(parts[0])
+	for _, part := range parts[1:] {
+		i := strings.Index(path[pos:], part)
+		if i < 0 {
+			return -1
+		}
+		pos += i + len(part)
+	}
+	if anchored && pos != len(path) && (len(parts) == 1 || !strings.HasSuffix(path, parts[len(parts)-1])) {
+		return -1
+	}
+	return len(rule)
+}
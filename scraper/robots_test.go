@@ -0,0 +1,94 @@
+package scraper
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRobots(t *testing.T) {
+	robots := `# comment
+User-agent: *
+Disallow: /private/
+Crawl-delay: 2
+
+User-agent: OtherBot
+User-agent: DocuStore
+Allow: /private/public
+Disallow: /private/
+Disallow: /tmp
+
+User-agent: BadBot
+Disallow: /
+
+Sitemap: https://example.com/sitemap.xml
+`
+	rules := parseRobots(strings.NewReader(robots), "DocuStore/1.0")
+	if !slices.Equal(rules.disallow, []string{"/private/", "/tmp"}) || !slices.Equal(rules.allow, []string{"/private/public"}) {
+		t.Errorf("specific group: allow %q, disallow %q", rules.allow, rules.disallow)
+	}
+	if rules.crawlDelay != 0 {
+		t.Errorf("crawl delay %s of the wildcard group applied", rules.crawlDelay)
+	}
+	if !slices.Equal(rules.sitemaps, []string{"https://example.com/sitemap.xml"}) {
+		t.Errorf("sitemaps %q", rules.sitemaps)
+	}
+
+	rules = parseRobots(strings.NewReader(robots), "SomeBot")
+	if !slices.Equal(rules.disallow, []string{"/private/"}) || len(rules.allow) != 0 {
+		t.Errorf("wildcard group: allow %q, disallow %q", rules.allow, rules.disallow)
+	}
+	if rules.crawlDelay.Seconds() != 2 {
+		t.Errorf("crawl delay %s, expected 2s", rules.crawlDelay)
+	}
+
+	cases := []struct {
+		path    string
+		allowed bool
+	}{
+		{"/", true},
+		{"/private/", false},
+		{"/private/page", false},
+		// the longest match wins
+		{"/private/public/page", true},
+		{"/tmpfile", false},
+		{"/docs/tmp", true},
+	}
+	rules = parseRobots(strings.NewReader(robots), "DocuStore")
+	for _, c := range cases {
+		if rules.allowed(c.path) != c.allowed {
+			t.Errorf("%s: allowed %v, expected %v", c.path, !c.allowed, c.allowed)
+		}
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	cases := []struct {
+		rule   string
+		path   string
+		length int
+	}{
+		{"/", "/page", 1},
+		{"/docs", "/docs/page", 5},
+		{"/docs", "/blog", -1},
+		{"/*.pdf", "/files/report.pdf", 6},
+		{"/*.pdf", "/files/report.html", -1},
+		{"/*.pdf$", "/report.pdf", 7},
+		{"/*.pdf$", "/report.pdf?download=1", -1},
+		{"/page$", "/page", 6},
+		{"/page$", "/page/2", -1},
+		{"/a*b*c", "/axxbyyc", 6},
+		{"/a*b*c", "/axxc", -1},
+	}
+	for _, c := range cases {
+		if length := robotsMatch(c.rule, c.path); length != c.length {
+			t.Errorf("rule %q on %q: %d, expected %d", c.rule, c.path, length, c.length)
+		}
+	}
+
+	// allow rules win ties
+	rules := &robotsRules{allow: []string{"/page"}, disallow: []string{"/page"}}
+	if !rules.allowed("/page") {
+		t.Error("a disallow rule won a tie")
+	}
+}
@@ -2,11 +2,14 @@ package scraper
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/wailsapp/wails/v2/pkg/logger"
@@ -15,21 +18,138 @@ import (
 
 var URLRegex = regexp.MustCompile(`^htt(p|ps)://(.*)(\s|$)`)
 
+// ScrapeOptions control how pages are downloaded and which text is kept.
+// Zero fields take their value from DefaultScrapeOptions.
+type ScrapeOptions struct {
+	Timeout   time.Duration // pages taking longer to download are given up on
+	UserAgent string
+	TextTags  []string // tags whose text is extracted
+}
+
+var DefaultScrapeOptions = ScrapeOptions{
+	Timeout:   30 * time.Second,
+	UserAgent: "DocuStore",
+	TextTags: []string{
+		"a",
+		"p",
+		"strong",
+		"code",
+		"span",
+		"h1",
+		"h2",
+		"h3",
+		"h4",
+		"h5",
+		"h6",
+	},
+}
+
+func (o ScrapeOptions) withDefaults() ScrapeOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultScrapeOptions.Timeout
+	}
+	if o.UserAgent == "" {
+		o.UserAgent = DefaultScrapeOptions.UserAgent
+	}
+	if len(o.TextTags) == 0 {
+		o.TextTags = DefaultScrapeOptions.TextTags
+	}
+	return o
+}
+
+// get downloads rawURL with the timeout and user agent of o.
+func (o ScrapeOptions) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", o.UserAgent)
+	client := &http.Client{Timeout: o.Timeout}
+	return client.Do(req)
+}
+
 type ScrapeData struct {
-	Title   string
-	Content string
+	Title       string
+	Description string
+	Headings    []string
+	Body        string // text outside of headings
+	// title, description and text of the page, as shown to the user
+	Content   string
+	Canonical string // normalized canonical URL declared by the page, if any
+	URL       string // URL the page was served from, after redirects
+	HTML      []byte // raw page source
 }
 
-func ScrapeText(url string, log logger.Logger) (*ScrapeData, error) {
-	buffer := bytes.NewBufferString("")
-	response, err := http.Get(strings.TrimSpace(url))
+// ScrapeText fetches the page at url and extracts its text.
+func ScrapeText(ctx context.Context, url string, opts ScrapeOptions, log logger.Logger) (*ScrapeData, error) {
+	body, pageURL, err := Fetch(ctx, url, opts)
 	if err != nil {
 		return nil, err
 	}
+	return ExtractFromHTML(bytes.NewReader(body), pageURL, opts, log)
+}
+
+// FetchError is returned when a page cannot be downloaded, because the server
+// could not be reached or answered with an error status.
+type FetchError struct {
+	URL        string
+	StatusCode int    // 0 if there was no response
+	Status     string // status line of the response, such as "404 Not Found"
+	Err        error  // cause of the failure if there was no response
+}
+
+func (e *FetchError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("fetching %s: unexpected status: %s", e.URL, e.Status)
+	}
+	return fmt.Sprintf("fetching %s: %s", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Fetch downloads the page at rawURL. It returns its raw HTML and the URL it
+// was served from, after redirects. Failures are returned as a *FetchError.
+func Fetch(ctx context.Context, rawURL string, opts ScrapeOptions) ([]byte, string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	response, err := opts.withDefaults().get(ctx, rawURL)
+	if err != nil {
+		// the client error repeats the URL
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, "", &FetchError{URL: rawURL, Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, "", &FetchError{URL: rawURL, StatusCode: response.StatusCode, Status: response.Status}
+	}
 	resBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", &FetchError{URL: rawURL, Err: err}
+	}
+	return resBody, response.Request.URL.String(), nil
+}
+
+// ExtractFromHTML extracts the title and the relevant text of a page that was
+// already fetched from baseURL.
+func ExtractFromHTML(r io.Reader, baseURL string, opts ScrapeOptions, log logger.Logger) (*ScrapeData, error) {
+	base, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, err
 	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseHTML(body, base, opts.withDefaults().TextTags, log)
+}
+
+// parseHTML extracts the title and the text inside textTags from raw HTML
+// served from base.
+func parseHTML(resBody []byte, base *url.URL, textTags []string, log logger.Logger) (*ScrapeData, error) {
+	buffer := bytes.NewBufferString("")
 	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(resBody))
 	if err != nil {
 		return nil, err
@@ -37,31 +157,17 @@ func ScrapeText(url string, log logger.Logger) (*ScrapeData, error) {
 
 	title := doc.Find("title").Text()
 	buffer.WriteString(title + "\n")
+	var description string
 	doc.Find("meta").Each(func(_ int, s *goquery.Selection) {
 		if name, _ := s.Attr("name"); strings.ToLower(name) == "description" {
-			description, _ := s.Attr("content")
+			description, _ = s.Attr("content")
 			buffer.WriteString(description + "\n")
 		}
 	})
-
-	textTags := []string{
-		"a",
-		"p",
-		"strong",
-		"code",
-		"span",
-		// "em",
-		// "string",
-		// "blockquote",
-		// "q",
-		// "cite",
-		"h1",
-		"h2",
-		"h3",
-		"h4",
-		"h5",
-		"h6",
-	}
+	body := bytes.NewBufferString("")
+	var headings []string
+	var heading strings.Builder
+	inHeading := false
 
 	tag := ""
 	enter := false
@@ -88,6 +194,10 @@ func ScrapeText(url string, log logger.Logger) (*ScrapeData, error) {
 			enter = false
 
 			tag = token.Data
+			if isHeading(tag) {
+				headings = appendHeading(headings, &heading)
+				inHeading = true
+			}
 			for _, ttt := range textTags {
 				if tag == ttt {
 					enter = true
@@ -102,14 +212,65 @@ func ScrapeText(url string, log logger.Logger) (*ScrapeData, error) {
 				if len(data) > 0 {
 					data = URLRegex.ReplaceAllString(data, "")
 					buffer.WriteString(data + " ")
+					if inHeading {
+						heading.WriteString(data + " ")
+					} else {
+						body.WriteString(data + " ")
+					}
 				}
 			}
+		case html.EndTagToken:
+			if isHeading(token.Data) {
+				headings = appendHeading(headings, &heading)
+				inHeading = false
+			}
 		}
 	}
-	result := &ScrapeData{Title: title, Content: buffer.String()}
+	headings = appendHeading(headings, &heading)
+	result := &ScrapeData{
+		Title:       title,
+		Description: description,
+		Headings:    headings,
+		Body:        body.String(),
+		Content:     buffer.String(),
+		HTML:        resBody,
+	}
+	result.Canonical = canonicalURL(doc, base)
+	if base != nil {
+		result.URL = base.String()
+	}
 	return result, nil
 }
 
+func isHeading(tag string) bool {
+	return len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6'
+}
+
+// appendHeading moves the text collected in heading to headings.
+func appendHeading(headings []string, heading *strings.Builder) []string {
+	text := strings.TrimSpace(heading.String())
+	heading.Reset()
+	if text == "" {
+		return headings
+	}
+	return append(headings, text)
+}
+
+// canonicalURL returns the normalized target of the page's canonical link.
+// Links to other hosts are ignored, a misconfigured page should not be able
+// to take over another site's document.
+func canonicalURL(doc *goquery.Document, base *url.URL) string {
+	href, ok := doc.Find(`link[rel~="canonical"]`).First().Attr("href")
+	if !ok || base == nil {
+		return ""
+	}
+	canonical, err := base.Parse(strings.TrimSpace(href))
+	if err != nil || !strings.EqualFold(canonical.Hostname(), base.Hostname()) {
+		return ""
+	}
+	return normalizeURL(canonical).String()
+}
+
 // func main() {
 // 	out := ScrapeText("https://spark.apache.org/docs/latest/")
 // 	fmt.Println("--------------")
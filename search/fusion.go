@@ -0,0 +1,37 @@
+package search
+
+import "sort"
+
+// dampens the advantage of the very first ranks in reciprocal rank fusion
+const rrfK = 60
+
+// FuseRRF merges ranked result lists with reciprocal rank fusion: a document
+// scores the sum of 1 / (k + rank) over the lists it appears in, so that
+// lists with incomparable scores can be combined. Documents of different
+// libraries are kept apart.
+func FuseRRF(lists ...[]*SearchResult) []*SearchResult {
+	fused := make(map[string]*SearchResult)
+	var order []string
+	for _, list := range lists {
+		for rank, result := range list {
+			score := 1 / float64(rrfK+rank+1)
+			key := result.Library + "/" + result.DocID
+			if merged, ok := fused[key]; ok {
+				merged.Score += score
+				continue
+			}
+			merged := *result
+			merged.Score = score
+			fused[key] = &merged
+			order = append(order, key)
+		}
+	}
+	results := make([]*SearchResult, 0, len(order))
+	for _, key := range order {
+		results = append(results, fused[key])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
@@ -11,7 +11,16 @@ import (
 
 var asciiRegex = regexp.MustCompile(`[^a-zA-Z0-9\s]`)
 
-var maxTokenLength int = 48
+// DefaultMaxTokenLength is the length tokens are truncated to, unless an
+// Analyzer sets another.
+const DefaultMaxTokenLength = 48
+
+// Analyzer splits texts into tokens.
+type Analyzer struct {
+	MaxTokenLength int // longer tokens are truncated
+}
+
+var defaultAnalyzer = Analyzer{MaxTokenLength: DefaultMaxTokenLength}
 
 type DocType int
 
@@ -31,12 +40,56 @@ func (t DocType) String() string {
 	}
 }
 
+// Field is a part of a document whose terms are weighted on their own.
+type Field int
+
+const (
+	BodyField Field = iota
+	TitleField
+	HeadingsField
+	URLField
+	DescriptionField
+)
+
+func (f Field) String() string {
+	switch f {
+	case BodyField:
+		return "body"
+	case TitleField:
+		return "title"
+	case HeadingsField:
+		return "headings"
+	case URLField:
+		return "URL"
+	case DescriptionField:
+		return "description"
+	default:
+		return "unknown"
+	}
+}
+
+// FieldBoosts multiply the term frequencies of each field when ranking.
+// Fields without a boost weigh 1.
+type FieldBoosts map[Field]float64
+
+// DefaultFieldBoosts make title matches outrank incidental body mentions.
+var DefaultFieldBoosts = FieldBoosts{
+	TitleField:       3,
+	HeadingsField:    2,
+	URLField:         1.5,
+	DescriptionField: 1.5,
+	BodyField:        1,
+}
+
 type DocSummary struct {
-	TermFreqs  map[string]float64
-	DocID      string
-	Title      string
-	Identifier string
-	Type       DocType
+	TermFreqs map[string]float64 // of all fields together
+	// term frequencies of each field, nil if the document only has a body
+	Fields      map[Field]map[string]float64
+	DocID       string
+	Title       string
+	Identifier  string
+	Type        DocType
+	Fingerprint uint64 // SimHash of TermFreqs
 }
 
 type SearchResult struct {
@@ -45,23 +98,86 @@ type SearchResult struct {
 	Identifier string
 	Type       string
 	Score      float64
+	Library    string `json:",omitempty"` // set by searches across libraries
 }
 
 func NewDocSummary(text string, identifier string, title string, docType DocType) *DocSummary {
-	termFreqs := getTermFrequency(text)
+	return defaultAnalyzer.NewDocSummary(text, identifier, title, docType)
+}
+
+// NewDocSummary summarizes a document, tokenized by a.
+func (a Analyzer) NewDocSummary(text string, identifier string, title string, docType DocType) *DocSummary {
+	termFreqs := a.TermFrequencies(text)
 	return &DocSummary{
-		DocID:      hashDocument(identifier),
-		Title:      title,
-		Identifier: identifier,
-		Type:       docType,
-		TermFreqs:  termFreqs,
+		DocID:       hashDocument(identifier),
+		Title:       title,
+		Identifier:  identifier,
+		Type:        docType,
+		TermFreqs:   termFreqs,
+		Fingerprint: SimHash(termFreqs),
 	}
 }
 
+// NewFieldDocSummary summarizes a document made of several fields, keeping
+// the term frequencies of each, with the default analyzer.
+func NewFieldDocSummary(fields map[Field]string, identifier string, title string, docType DocType) *DocSummary {
+	return defaultAnalyzer.NewFieldDocSummary(fields, identifier, title, docType)
+}
+
+// NewFieldDocSummary summarizes a document made of several fields, tokenized
+// by a.
+func (a Analyzer) NewFieldDocSummary(fields map[Field]string, identifier string, title string, docType DocType) *DocSummary {
+	fieldFreqs := make(map[Field]map[string]float64, len(fields))
+	var all strings.Builder
+	for field, text := range fields {
+		termFreqs := a.TermFrequencies(text)
+		if len(termFreqs) == 0 {
+			continue
+		}
+		fieldFreqs[field] = termFreqs
+		all.WriteString(text + "\n")
+	}
+	doc := a.NewDocSummary(all.String(), identifier, title, docType)
+	doc.Fields = fieldFreqs
+	return doc
+}
+
+// WeightedFreq returns the frequency of token in the document, weighting
+// each field by its boost.
+func (d *DocSummary) WeightedFreq(token string, boosts FieldBoosts) float64 {
+	if d.Fields == nil {
+		return d.TermFreqs[token]
+	}
+	var freq float64
+	for field, termFreqs := range d.Fields {
+		boost, ok := boosts[field]
+		if !ok {
+			boost = 1
+		}
+		freq += boost * termFreqs[token]
+	}
+	return freq
+}
+
 type Searcher interface {
 	Search(text string, docs ...*DocSummary) []*SearchResult
 }
 
+// TermSearcher also ranks documents by their similarity to weighted terms,
+// such as the most distinctive terms of another document.
+type TermSearcher interface {
+	Searcher
+	// TopTerms returns the n terms of doc with the highest weight, with their
+	// frequency in doc
+	TopTerms(doc *DocSummary, n int) map[string]float64
+	SearchTerms(termFreqs map[string]float64, docs ...*DocSummary) []*SearchResult
+}
+
+// DocumentID returns the ID of the document stored under identifier.
+func DocumentID(identifier string) string {
+	return hashDocument(identifier)
+}
+
 func hashDocument(text string) string {
 	hash := sha256.Sum256([]byte(text))
 	hashString := hex.EncodeToString(hash[:])
@@ -69,6 +185,10 @@ func hashDocument(text string) string {
 }
 
 func Tokenize(text string) []string {
+	return defaultAnalyzer.Tokenize(text)
+}
+
+func (a Analyzer) Tokenize(text string) []string {
 	text = unidecode.Unidecode(text)
 	text = strings.ToLower(text)
 	text = asciiRegex.ReplaceAllString(text, "")
@@ -76,16 +196,21 @@ func Tokenize(text string) []string {
 	var t string
 	for i := 0; i < len(tokens); i++ {
 		t = tokens[i]
-		if len(t) > maxTokenLength {
-			t = t[:maxTokenLength]
+		if len(t) > a.MaxTokenLength {
+			t = t[:a.MaxTokenLength]
 			tokens[i] = t
 		}
 	}
 	return tokens
 }
 
-func getTermFrequency(text string) map[string]float64 {
-	tokens := Tokenize(text)
+// TermFrequencies returns the frequency of each token of text.
+func TermFrequencies(text string) map[string]float64 {
+	return defaultAnalyzer.TermFrequencies(text)
+}
+
+func (a Analyzer) TermFrequencies(text string) map[string]float64 {
+	tokens := a.Tokenize(text)
 	termCounts := make(map[string]int)
 	nTokens := float64(len(tokens))
 	for _, token := range tokens {
@@ -121,3 +246,16 @@ func (d *DocCounter) AddDocument(DocSummary *DocSummary, timestamp int64) {
 		d.Ts = timestamp
 	}
 }
+
+// RemoveDocument undoes AddDocument. timestamp is the latest change of the
+// remaining documents.
+func (d *DocCounter) RemoveDocument(DocSummary *DocSummary, timestamp int64) {
+	d.NumDocs--
+	for token := range DocSummary.TermFreqs {
+		d.DocCounts[token]--
+		if d.DocCounts[token] <= 0 {
+			delete(d.DocCounts, token)
+		}
+	}
+	d.Ts = timestamp
+}
@@ -0,0 +1,129 @@
+package search
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"sort"
+)
+
+// Fingerprints at most this many bits apart belong to near-duplicate documents.
+const NearDuplicateDistance = 3
+
+// SimHash computes a 64-bit fingerprint of a document from its term
+// frequencies. Similar documents get fingerprints with a small Hamming
+// distance between them.
+func SimHash(termFreqs map[string]float64) uint64 {
+	// sum in a fixed order, float addition is not associative
+	tokens := make([]string, 0, len(termFreqs))
+	for token := range termFreqs {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+
+	var weights [64]float64
+	hasher := fnv.New64a()
+	for _, token := range tokens {
+		freq := termFreqs[token]
+		hasher.Reset()
+		hasher.Write([]byte(token))
+		hash := hasher.Sum64()
+		for i := 0; i < 64; i++ {
+			if hash&(1<<i) != 0 {
+				weights[i] += freq
+			} else {
+				weights[i] -= freq
+			}
+		}
+	}
+	var fingerprint uint64
+	for i, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << i
+		}
+	}
+	return fingerprint
+}
+
+// HammingDistance is the number of bits that differ between two fingerprints.
+func HammingDistance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// FingerprintBands splits a fingerprint into maxDistance+1 blocks of bits.
+// By the pigeonhole principle, fingerprints at most maxDistance bits apart
+// are identical in at least one block, so near-duplicates can be found by
+// looking up the blocks.
+func FingerprintBands(fingerprint uint64, maxDistance int) []uint64 {
+	nBlocks := maxDistance + 1
+	width := 64 / nBlocks
+	bands := make([]uint64, nBlocks)
+	for block := range bands {
+		shift := block * width
+		mask := uint64(1)<<width - 1
+		if block == nBlocks-1 {
+			mask = ^uint64(0) >> shift
+		}
+		bands[block] = (fingerprint >> shift) & mask
+	}
+	return bands
+}
+
+// NearDuplicateClusters groups document IDs whose fingerprints are at most
+// maxDistance bits apart, transitively. Only groups with more than one
+// document are returned.
+func NearDuplicateClusters(fingerprints map[string]uint64, maxDistance int) [][]string {
+	docIDs := make([]string, 0, len(fingerprints))
+	for docID := range fingerprints {
+		docIDs = append(docIDs, docID)
+	}
+	sort.Strings(docIDs)
+
+	parent := make([]int, len(docIDs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	bands := make([][]uint64, len(docIDs))
+	for i, docID := range docIDs {
+		bands[i] = FingerprintBands(fingerprints[docID], maxDistance)
+	}
+	for block := 0; block <= maxDistance; block++ {
+		buckets := make(map[uint64][]int)
+		for i := range docIDs {
+			buckets[bands[i][block]] = append(buckets[bands[i][block]], i)
+		}
+		for _, bucket := range buckets {
+			for x := 0; x < len(bucket); x++ {
+				for y := x + 1; y < len(bucket); y++ {
+					i, j := bucket[x], bucket[y]
+					if HammingDistance(fingerprints[docIDs[i]], fingerprints[docIDs[j]]) <= maxDistance {
+						parent[find(i)] = find(j)
+					}
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]string)
+	for i, docID := range docIDs {
+		root := find(i)
+		groups[root] = append(groups[root], docID)
+	}
+	clusters := make([][]string, 0)
+	for _, group := range groups {
+		if len(group) > 1 {
+			clusters = append(clusters, group)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i][0] < clusters[j][0]
+	})
+	return clusters
+}
@@ -0,0 +1,108 @@
+package search
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestHammingDistance(t *testing.T) {
+	cases := []struct {
+		a, b     uint64
+		distance int
+	}{
+		{0, 0, 0},
+		{0b1011, 0b1011, 0},
+		{0b1011, 0b0011, 1},
+		{0, ^uint64(0), 64},
+		{1 << 63, 1, 2},
+	}
+	for _, c := range cases {
+		if distance := HammingDistance(c.a, c.b); distance != c.distance {
+			t.Errorf("distance between %b and %b: %d, expected %d", c.a, c.b, distance, c.distance)
+		}
+	}
+}
+
+func TestSimHash(t *testing.T) {
+	words := loadWords()
+	rng := rand.New(rand.NewSource(1))
+	doc := make(map[string]float64)
+	for len(doc) < 200 {
+		doc[words[rng.Intn(len(words))]] = float64(1 + rng.Intn(5))
+	}
+	edited := make(map[string]float64, len(doc))
+	for word, freq := range doc {
+		edited[word] = freq
+	}
+	edited["zzzunusual"] = 1
+	other := make(map[string]float64)
+	for len(other) < 200 {
+		other[words[rng.Intn(len(words))]] = float64(1 + rng.Intn(5))
+	}
+
+	fingerprint := SimHash(doc)
+	for i := 0; i < 10; i++ {
+		if SimHash(doc) != fingerprint {
+			t.Fatal("SimHash is not deterministic")
+		}
+	}
+	if distance := HammingDistance(fingerprint, SimHash(edited)); distance > NearDuplicateDistance {
+		t.Errorf("an edited document is %d bits apart", distance)
+	}
+	if distance := HammingDistance(fingerprint, SimHash(other)); distance <= NearDuplicateDistance {
+		t.Errorf("an unrelated document is only %d bits apart", distance)
+	}
+	if SimHash(nil) != 0 {
+		t.Error("the fingerprint of an empty document is not 0")
+	}
+}
+
+func TestFingerprintBands(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		a := rng.Uint64()
+		b := a
+		for flips := rng.Intn(NearDuplicateDistance + 1); flips > 0; flips-- {
+			b ^= 1 << rng.Intn(64)
+		}
+		bandsA := FingerprintBands(a, NearDuplicateDistance)
+		bandsB := FingerprintBands(b, NearDuplicateDistance)
+		if len(bandsA) != NearDuplicateDistance+1 {
+			t.Fatalf("%d bands", len(bandsA))
+		}
+		shared := false
+		for band := range bandsA {
+			shared = shared || bandsA[band] == bandsB[band]
+		}
+		if !shared {
+			t.Fatalf("%x and %x share no band", a, b)
+		}
+	}
+	// the bands hold every bit
+	bands := FingerprintBands(^uint64(0), 2)
+	if !slices.Equal(bands, []uint64{1<<21 - 1, 1<<21 - 1, 1<<22 - 1}) {
+		t.Errorf("bands %x", bands)
+	}
+}
+
+func TestNearDuplicateClusters(t *testing.T) {
+	fingerprints := map[string]uint64{
+		"e": 0b0111,
+		"a": 0,
+		"c": 0b1 << 40,
+		"b": 0b11,
+		"d": ^uint64(0),
+		"f": ^uint64(0) ^ 0b1,
+		"g": 0xF0F0F0F0,
+	}
+	clusters := NearDuplicateClusters(fingerprints, 2)
+	// e is 3 bits from a, but 1 bit from b, which is close to a
+	expected := [][]string{{"a", "b", "c", "e"}, {"d", "f"}}
+	if !slices.EqualFunc(clusters, expected, slices.Equal) {
+		t.Errorf("clusters %q, expected %q", clusters, expected)
+	}
+	if clusters := NearDuplicateClusters(fingerprints, 0); len(clusters) != 0 {
+		t.Errorf("clusters %q of identical fingerprints", clusters)
+	}
+}
@@ -3,52 +3,82 @@ package search
 import (
 	"math"
 	"sort"
+	"sync"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 )
 
 const CACHE_SIZE = 1024
 
+// tfidfSearcher is safe for concurrent use, as long as the counter does not
+// change while searching.
 type tfidfSearcher struct {
-	counter *DocCounter
+	counter  *DocCounter
+	analyzer Analyzer
+	boosts   FieldBoosts
+	cache    *lru.Cache[string, float64]
+
+	mu sync.Mutex
+	// replaced, never modified, when the counter changes
 	idf     map[string]float64
-	cache   *lru.Cache[string, float64]
 	ts      int64
+	numDocs int
+}
+
+func NewTFIDFSearcher(c *DocCounter) (TermSearcher, error) {
+	return NewBoostedTFIDFSearcher(c, defaultAnalyzer, DefaultFieldBoosts)
 }
 
-func NewTFIDFSearcher(c *DocCounter) (Searcher, error) {
+// NewBoostedTFIDFSearcher creates a TF-IDF searcher that tokenizes queries
+// with analyzer and weighs the fields of documents with the given boosts.
+func NewBoostedTFIDFSearcher(c *DocCounter, analyzer Analyzer, boosts FieldBoosts) (TermSearcher, error) {
 	cache, err := lru.New[string, float64](CACHE_SIZE)
 	if err != nil {
 		return nil, err
 	}
 	return &tfidfSearcher{
-		counter: c,
-		idf:     make(map[string]float64),
-		cache:   cache,
+		counter:  c,
+		analyzer: analyzer,
+		boosts:   boosts,
+		idf:      make(map[string]float64),
+		cache:    cache,
 	}, nil
 }
 
-func (s *tfidfSearcher) calculateIDF() {
-	if s.ts != s.counter.Ts {
+// IDF returns the inverse document frequency of a token found in docCount
+// of numDocs documents.
+func IDF(numDocs int, docCount int) float64 {
+	return math.Log(float64(numDocs)/(1+float64(docCount))) + 1
+}
+
+func (s *tfidfSearcher) calculateIDF() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// removing a document does not necessarily change the timestamp
+	if s.ts != s.counter.Ts || s.numDocs != s.counter.NumDocs {
+		s.idf = make(map[string]float64, len(s.counter.DocCounts))
 		for token, count := range s.counter.DocCounts {
-			s.idf[token] = math.Log(float64(s.counter.NumDocs)/(1+float64(count))) + 1
+			s.idf[token] = IDF(s.counter.NumDocs, count)
 		}
 		s.ts = s.counter.Ts
+		s.numDocs = s.counter.NumDocs
 	}
+	return s.idf
 }
 
-func (s *tfidfSearcher) getCachedNorm(doc *DocSummary) float64 {
+func (s *tfidfSearcher) getCachedNorm(doc *DocSummary, idf map[string]float64) float64 {
 	norm, ok := s.cache.Get(doc.DocID)
 	if ok {
 		return norm
 	}
-	return s.computeNorm(doc)
+	return s.computeNorm(doc, idf)
 }
 
-func (s *tfidfSearcher) computeNorm(doc *DocSummary) float64 {
+func (s *tfidfSearcher) computeNorm(doc *DocSummary, idf map[string]float64) float64 {
 	var norm float64
-	for token, count := range doc.TermFreqs {
-		factor, ok := s.idf[token]
+	for token := range doc.TermFreqs {
+		count := doc.WeightedFreq(token, s.boosts)
+		factor, ok := idf[token]
 		if !ok {
 			factor = 1.0
 		}
@@ -59,15 +89,58 @@ func (s *tfidfSearcher) computeNorm(doc *DocSummary) float64 {
 }
 
 func (s *tfidfSearcher) Search(text string, docs ...*DocSummary) []*SearchResult {
-	termFreqs := getTermFrequency(text)
-	s.calculateIDF()
+	return s.searchFreqs(s.analyzer.TermFrequencies(text), docs)
+}
+
+// TopTerms returns the n terms of doc with the highest TF-IDF weight.
+func (s *tfidfSearcher) TopTerms(doc *DocSummary, n int) map[string]float64 {
+	idf := s.calculateIDF()
+	type weightedTerm struct {
+		token  string
+		freq   float64
+		weight float64
+	}
+	terms := make([]weightedTerm, 0, len(doc.TermFreqs))
+	for token := range doc.TermFreqs {
+		freq := doc.WeightedFreq(token, s.boosts)
+		factor, ok := idf[token]
+		if !ok {
+			factor = 1.0
+		}
+		terms = append(terms, weightedTerm{token, freq, freq * factor})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].weight != terms[j].weight {
+			return terms[i].weight > terms[j].weight
+		}
+		return terms[i].token < terms[j].token
+	})
+	top := make(map[string]float64, min(n, len(terms)))
+	for _, term := range terms[:min(n, len(terms))] {
+		top[term.token] = term.freq
+	}
+	return top
+}
+
+func (s *tfidfSearcher) SearchTerms(termFreqs map[string]float64, docs ...*DocSummary) []*SearchResult {
+	query := make(map[string]float64, len(termFreqs))
+	for token, freq := range termFreqs {
+		query[token] = freq
+	}
+	return s.searchFreqs(query, docs)
+}
+
+// searchFreqs ranks docs by their similarity to the query term frequencies,
+// which are overwritten.
+func (s *tfidfSearcher) searchFreqs(termFreqs map[string]float64, docs []*DocSummary) []*SearchResult {
+	idf := s.calculateIDF()
 	scores := make([]float64, len(docs))
 	var queryNorm float64
 	docNorms := make([]float64, len(docs))
 
 	var value float64
 	for token, queryCount := range termFreqs {
-		factor, ok := s.idf[token]
+		factor, ok := idf[token]
 		if !ok {
 			factor = 1.0
 		}
@@ -79,10 +152,10 @@ func (s *tfidfSearcher) Search(text string, docs ...*DocSummary) []*SearchResult
 
 	var norm, refCount float64
 	for i, doc := range docs {
-		norm = s.getCachedNorm(doc)
+		norm = s.getCachedNorm(doc, idf)
 		docNorms[i] = norm
 		for token, value := range termFreqs {
-			refCount = doc.TermFreqs[token]
+			refCount = doc.WeightedFreq(token, s.boosts)
 			scores[i] += value * refCount
 		}
 	}
@@ -70,3 +70,83 @@ func BenchmarkTfidf(b *testing.B) {
 		}
 	}
 }
+
+func TestFieldBoosts(t *testing.T) {
+	body := "a long article about cluster computing that mentions spark once among many other words"
+	titled := NewFieldDocSummary(map[Field]string{
+		TitleField: "Spark tuning guide",
+		BodyField:  "memory settings for executors and drivers in a cluster",
+	}, "titled", "Spark tuning guide", URL)
+	incidental := NewFieldDocSummary(map[Field]string{
+		TitleField: "Cluster computing",
+		BodyField:  body + " spark",
+	}, "incidental", "Cluster computing", URL)
+
+	counter := NewDocCounter()
+	counter.AddDocument(titled, 1)
+	counter.AddDocument(incidental, 2)
+	searcher, err := NewTFIDFSearcher(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := searcher.Search("spark", titled, incidental)
+	if results[0].DocID != titled.DocID {
+		t.Errorf("title match ranked below body mentions: %+v, %+v", results[0], results[1])
+	}
+
+	unboosted, err := NewBoostedTFIDFSearcher(counter, defaultAnalyzer, FieldBoosts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Score <= unboosted.Search("spark", titled)[0].Score {
+		t.Error("title boost did not raise the score of the title match")
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	short := Analyzer{MaxTokenLength: 5}
+	if tokens := short.Tokenize("Élégant configuration"); len(tokens) != 2 || tokens[0] != "elega" || tokens[1] != "confi" {
+		t.Errorf("tokens %q", tokens)
+	}
+	if tokens := Tokenize("configuration"); tokens[0] != "configuration" {
+		t.Errorf("default analyzer tokens %q", tokens)
+	}
+
+	// queries are tokenized like the documents
+	doc := short.NewDocSummary("configuration files", "doc", "doc", Text)
+	counter := NewDocCounter()
+	counter.AddDocument(doc, 1)
+	searcher, err := NewBoostedTFIDFSearcher(counter, short, DefaultFieldBoosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := searcher.Search("configure", doc); len(results) != 1 || results[0].Score == 0 {
+		t.Errorf("truncated query not matched: %+v", results)
+	}
+}
+
+func TestSimilarTerms(t *testing.T) {
+	sparkDoc := NewDocSummary("spark executors need memory, spark drivers need memory too", "spark", "Spark", Text)
+	sparkNotes := NewDocSummary("notes on spark executors and their memory", "spark notes", "Spark notes", Text)
+	cooking := NewDocSummary("bread needs flour, water and time", "cooking", "Cooking", Text)
+	counter := NewDocCounter()
+	for i, doc := range []*DocSummary{sparkDoc, sparkNotes, cooking} {
+		counter.AddDocument(doc, int64(i))
+	}
+	searcher, err := NewTFIDFSearcher(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms := searcher.TopTerms(sparkDoc, 3)
+	spark := terms["spark"]
+	if len(terms) != 3 || terms["need"] == 0 || terms["memory"] == 0 || spark == 0 {
+		t.Errorf("unexpected top terms %v", terms)
+	}
+	results := searcher.SearchTerms(terms, cooking, sparkNotes)
+	if results[0].DocID != sparkNotes.DocID || results[1].Score != 0 {
+		t.Errorf("unexpected ranking %+v, %+v", results[0], results[1])
+	}
+	if terms["spark"] != spark {
+		t.Error("SearchTerms modified the query terms")
+	}
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"DocuStore/search"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+// number of segments of a level merged into one segment of the next level
+const mergeFactor = 8
+
+const manifestFile = "MANIFEST"
+
+// version of the segment format, indexes of other versions are rebuilt
+const indexVersion = 1
+
+// SegmentedIndex is an inverted index persisted like a log-structured merge
+// tree: every change is written as a new immutable segment file, and a
+// manifest lists the segments in order. Runs of segments of the same level
+// are merged in the background, so that their number stays logarithmic in
+// the number of documents, and adding a document costs O(document size).
+type SegmentedIndex struct {
+	dir      string
+	log      logger.Logger
+	boosts   search.FieldBoosts // weights of the fields of documents
+	mu       sync.RWMutex
+	segments []*segment
+	// timestamp of latest change
+	timestamp int64
+	// segment holding the live version of each document
+	owner map[string]*segment
+	// number of live documents containing each token
+	counter *search.DocCounter
+	nextID  int
+	merging bool
+	merges  sync.WaitGroup
+	// nothing is written to dir, a Reset is only kept in memory
+	readOnly bool
+}
+
+var errReadOnlyIndex = errors.New("the index is open read-only")
+
+var _ Index = (*SegmentedIndex)(nil)
+
+type segment struct {
+	ID    int
+	Level int
+	Docs  *InvertedIndex
+	// documents removed from the previous segments
+	Deleted []string
+}
+
+type manifest struct {
+	Version   int
+	Segments  []int // IDs of the segments, oldest first
+	NextID    int
+	Timestamp int64
+	// weights of the fields the postings were computed with
+	Boosts search.FieldBoosts
+}
+
+// OpenSegmentedIndex loads the index stored in dir. If there is none, the
+// error wraps os.ErrNotExist and the returned index is empty. An index
+// computed with other field boosts is not loaded either.
+func OpenSegmentedIndex(dir string, boosts search.FieldBoosts, log logger.Logger) (*SegmentedIndex, error) {
+	s := newSegmentedIndex(dir, boosts, log)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return s, err
+	}
+	err = s.load()
+	if err != nil {
+		return s, err
+	}
+	s.removeOrphans()
+	return s, nil
+}
+
+// OpenReadOnlySegmentedIndex loads the index stored in dir like
+// OpenSegmentedIndex, without ever writing to dir. Documents cannot be
+// inserted or removed, and a Reset is only kept in memory.
+func OpenReadOnlySegmentedIndex(dir string, boosts search.FieldBoosts, log logger.Logger) (*SegmentedIndex, error) {
+	s := newSegmentedIndex(dir, boosts, log)
+	s.readOnly = true
+	return s, s.load()
+}
+
+func newSegmentedIndex(dir string, boosts search.FieldBoosts, log logger.Logger) *SegmentedIndex {
+	return &SegmentedIndex{
+		dir:     dir,
+		log:     log,
+		boosts:  boosts,
+		owner:   make(map[string]*segment),
+		counter: search.NewDocCounter(),
+	}
+}
+
+// load reads the manifest and the segments it lists.
+func (s *SegmentedIndex) load() error {
+	var m manifest
+	err := LoadStruct(filepath.Join(s.dir, manifestFile), &m)
+	if err != nil {
+		return err
+	}
+	if m.Version != indexVersion {
+		return fmt.Errorf("index format version %d, expected %d", m.Version, indexVersion)
+	}
+	if !maps.Equal(m.Boosts, s.boosts) {
+		return errors.New("the field boosts changed")
+	}
+	for _, id := range m.Segments {
+		seg := &segment{}
+		err = LoadStruct(s.segmentPath(id), seg)
+		if err != nil {
+			s.segments = nil
+			s.owner = make(map[string]*segment)
+			return err
+		}
+		s.add(seg)
+	}
+	s.nextID = m.NextID
+	s.timestamp = m.Timestamp
+	s.countDocs()
+	return nil
+}
+
+func (s *SegmentedIndex) segmentPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%08d.seg", id))
+}
+
+// add appends a segment, replacing older versions of its documents.
+func (s *SegmentedIndex) add(seg *segment) {
+	s.segments = append(s.segments, seg)
+	for _, docID := range seg.Deleted {
+		delete(s.owner, docID)
+	}
+	for _, doc := range seg.Docs.Docs {
+		if doc.DocID != "" {
+			s.owner[doc.DocID] = seg
+		}
+	}
+}
+
+// removeOrphans deletes the files of segments left out of the manifest,
+// such as those of an interrupted merge.
+func (s *SegmentedIndex) removeOrphans() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	live := make(map[string]bool, len(s.segments))
+	for _, seg := range s.segments {
+		live[filepath.Base(s.segmentPath(seg.ID))] = true
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name != manifestFile && !live[name] && (strings.HasSuffix(name, ".seg") || strings.HasSuffix(name, ".tmp")) {
+			os.Remove(filepath.Join(s.dir, name))
+		}
+	}
+}
+
+// NumDocs returns the number of documents in the index.
+func (s *SegmentedIndex) NumDocs() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.owner)
+}
+
+// InsertDoc adds a document to the index, replacing its previous version.
+func (s *SegmentedIndex) InsertDoc(doc *search.DocSummary, timestamp int64) error {
+	docs := NewInvertedIndex()
+	docs.InsertDoc(doc, s.boosts, timestamp)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, replaced := s.owner[doc.DocID]
+	var previousTokens []string
+	if replaced {
+		previousTokens = previous.docTokens(previous.Docs.DocNums[doc.DocID])
+	} else {
+		// the document counts in the weights of its own tokens
+		s.counter.AddDocument(doc, timestamp)
+	}
+	docs.weigh(s.idf)
+	err := s.write(&segment{Docs: docs}, timestamp)
+	if err != nil && !replaced {
+		s.counter.RemoveDocument(doc, s.timestamp)
+	}
+	if err == nil && replaced {
+		for _, token := range previousTokens {
+			s.counter.DocCounts[token]--
+			if s.counter.DocCounts[token] <= 0 {
+				delete(s.counter.DocCounts, token)
+			}
+		}
+		for token := range doc.TermFreqs {
+			s.counter.DocCounts[token]++
+		}
+		s.counter.Ts = s.timestamp
+	}
+	return err
+}
+
+// docTokens returns the tokens of document num of the segment. Posting lists
+// are sorted by document number, so each is read up to num only.
+func (seg *segment) docTokens(num uint32) []string {
+	var tokens []string
+	for token, list := range seg.Docs.Lists {
+		cursor := postingCursor{data: list.Data}
+		for cursor.next() && cursor.num <= num {
+			if cursor.num == num {
+				tokens = append(tokens, token)
+				break
+			}
+		}
+	}
+	return tokens
+}
+
+// RemoveDoc removes a document from the index.
+func (s *SegmentedIndex) RemoveDoc(doc *search.DocSummary, timestamp int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, live := s.owner[doc.DocID]
+	err := s.write(&segment{Docs: NewInvertedIndex(), Deleted: []string{doc.DocID}}, timestamp)
+	if err != nil {
+		return err
+	}
+	if live {
+		s.counter.RemoveDocument(doc, timestamp)
+	}
+	s.counter.Ts = timestamp
+	return nil
+}
+
+// write stores a new segment and adds it to the manifest. s.mu must be held.
+func (s *SegmentedIndex) write(seg *segment, timestamp int64) error {
+	if s.readOnly {
+		return errReadOnlyIndex
+	}
+	seg.ID = s.nextID
+	s.nextID++
+	err := SaveStruct(s.segmentPath(seg.ID), seg)
+	if err != nil {
+		return err
+	}
+	s.add(seg)
+	s.timestamp = timestamp
+	err = s.saveManifest()
+	if err != nil {
+		return err
+	}
+	s.startMerge()
+	return nil
+}
+
+// idf returns the inverse document frequency of a token. s.mu must be held,
+// for reading at least.
+func (s *SegmentedIndex) idf(token string) float64 {
+	return search.IDF(s.counter.NumDocs, s.counter.DocCounts[token])
+}
+
+// saveManifest replaces the manifest, atomically so that an interrupted
+// write keeps the previous one.
+func (s *SegmentedIndex) saveManifest() error {
+	m := manifest{Version: indexVersion, NextID: s.nextID, Timestamp: s.timestamp, Boosts: s.boosts}
+	for _, seg := range s.segments {
+		m.Segments = append(m.Segments, seg.ID)
+	}
+	path := filepath.Join(s.dir, manifestFile)
+	err := SaveStruct(path+".tmp", m)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Reset replaces the contents of the index with docs, in a single segment.
+func (s *SegmentedIndex) Reset(docs *InvertedIndex, timestamp int64) error {
+	s.merges.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg := &segment{ID: s.nextID, Docs: docs}
+	for n := len(docs.Docs); n >= mergeFactor; n /= mergeFactor {
+		seg.Level++
+	}
+	s.nextID++
+	s.segments = nil
+	s.owner = make(map[string]*segment)
+	s.add(seg)
+	s.timestamp = timestamp
+	s.countDocs()
+	docs.weigh(s.idf)
+	if s.readOnly {
+		return nil
+	}
+	err := SaveStruct(s.segmentPath(seg.ID), seg)
+	if err != nil {
+		return err
+	}
+	err = s.saveManifest()
+	if err != nil {
+		return err
+	}
+	s.removeOrphans()
+	return nil
+}
+
+// Timestamp returns the timestamp of the latest change.
+func (s *SegmentedIndex) Timestamp() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.timestamp
+}
+
+// Close waits for the background merges to finish.
+func (s *SegmentedIndex) Close() error {
+	s.merges.Wait()
+	return nil
+}
+
+// startMerge merges a run of segments in the background if there is one and
+// no merge is running.
+func (s *SegmentedIndex) startMerge() {
+	if s.merging {
+		return
+	}
+	run := s.mergeableRun()
+	if run == nil {
+		return
+	}
+	s.merging = true
+	s.merges.Add(1)
+	go func() {
+		defer s.merges.Done()
+		err := s.merge(run)
+		if err != nil {
+			s.log.Warning(fmt.Sprintf("error merging index segments: %s", err))
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.merging = false
+		if err == nil {
+			s.startMerge()
+		}
+	}()
+}
+
+// mergeableRun returns the oldest run of mergeFactor segments of the same
+// level, or nil. Merging the oldest one keeps levels decreasing from the
+// oldest segments to the newest.
+func (s *SegmentedIndex) mergeableRun() []*segment {
+	for start := 0; start+mergeFactor <= len(s.segments); start++ {
+		run := s.segments[start : start+mergeFactor]
+		same := true
+		for _, seg := range run {
+			same = same && seg.Level == run[0].Level
+		}
+		if same {
+			return slices.Clone(run)
+		}
+	}
+	return nil
+}
+
+// merge replaces a run of segments with a single one, dropping removed and
+// replaced documents.
+func (s *SegmentedIndex) merge(run []*segment) error {
+	s.mu.Lock()
+	id := s.nextID
+	s.nextID++
+	// documents replaced during the merge stay in the merged segment, where
+	// they are not live
+	live := make([]map[string]bool, len(run))
+	for i, seg := range run {
+		live[i] = make(map[string]bool, len(seg.Docs.Docs))
+		for _, doc := range seg.Docs.Docs {
+			live[i][doc.DocID] = doc.DocID != "" && s.owner[doc.DocID] == seg
+		}
+	}
+	// norms are refreshed with the current document frequencies
+	counter := &search.DocCounter{NumDocs: s.counter.NumDocs, DocCounts: maps.Clone(s.counter.DocCounts)}
+	// removals must still apply to older segments
+	var deleted []string
+	if s.segments[0] != run[0] {
+		seen := make(map[string]bool)
+		for _, seg := range run {
+			for _, docID := range seg.Deleted {
+				if !seen[docID] {
+					seen[docID] = true
+					deleted = append(deleted, docID)
+				}
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	indexes := make([]*InvertedIndex, len(run))
+	for i, seg := range run {
+		indexes[i] = seg.Docs
+	}
+	merged := &segment{
+		ID:    id,
+		Level: run[0].Level + 1,
+		Docs: mergeIndexes(indexes, func(i int, docID string) bool {
+			return live[i][docID]
+		}),
+		Deleted: deleted,
+	}
+	merged.Docs.weigh(func(token string) float64 {
+		return search.IDF(counter.NumDocs, counter.DocCounts[token])
+	})
+	err := SaveStruct(s.segmentPath(id), merged)
+	if err != nil {
+		os.Remove(s.segmentPath(id))
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := slices.Index(s.segments, run[0])
+	if start < 0 || start+len(run) > len(s.segments) || !slices.Equal(s.segments[start:start+len(run)], run) {
+		os.Remove(s.segmentPath(id))
+		return errors.New("index segments changed during merge")
+	}
+	s.segments = slices.Replace(s.segments, start, start+len(run), merged)
+	for _, doc := range merged.Docs.Docs {
+		if slices.Contains(run, s.owner[doc.DocID]) {
+			s.owner[doc.DocID] = merged
+		}
+	}
+	// if the manifest cannot be saved, the segments it lists are kept and the
+	// merged one is listed by the next manifest
+	err = s.saveManifest()
+	if err != nil {
+		return err
+	}
+	for _, seg := range run {
+		os.Remove(s.segmentPath(seg.ID))
+	}
+	return nil
+}
+
+// SearchTokens returns the documents containing any of the tokens.
+func (s *SegmentedIndex) SearchTokens(tokens []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[string]bool)
+	out := make([]string, 0)
+	for _, seg := range s.segments {
+		for _, token := range tokens {
+			list, ok := seg.Docs.Lists[token]
+			if !ok {
+				continue
+			}
+			list.each(func(n uint32, _ uint32) {
+				docID := seg.Docs.Docs[n].DocID
+				if !seen[docID] && s.owner[docID] == seg {
+					seen[docID] = true
+					out = append(out, docID)
+				}
+			})
+		}
+	}
+	return out
+}
+
+// Postings returns the documents containing token with its frequency in
+// each.
+func (s *SegmentedIndex) Postings(token string) []Posting {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Posting
+	for _, seg := range s.segments {
+		for _, posting := range seg.Docs.Postings(token) {
+			if s.owner[posting.DocID] == seg {
+				out = append(out, posting)
+			}
+		}
+	}
+	return out
+}
+
+// Counter returns the number of live documents containing each token, kept
+// up to date with the index.
+func (s *SegmentedIndex) Counter() *search.DocCounter {
+	return s.counter
+}
+
+// countDocs counts the live documents containing each token. s.mu must be
+// held.
+func (s *SegmentedIndex) countDocs() {
+	counts := make(map[string]int)
+	for _, seg := range s.segments {
+		for token, list := range seg.Docs.Lists {
+			list.each(func(n uint32, _ uint32) {
+				if s.owner[seg.Docs.Docs[n].DocID] == seg {
+					counts[token]++
+				}
+			})
+		}
+	}
+	// searchers keep a pointer to the counter
+	s.counter.DocCounts = counts
+	s.counter.NumDocs = len(s.owner)
+	s.counter.Ts = s.timestamp
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"DocuStore/search"
+
+	"github.com/wailsapp/wails/v2/pkg/logger"
+)
+
+func TestSegmentedIndex(t *testing.T) {
+	dir := t.TempDir()
+	log := logger.NewDefaultLogger()
+	index, err := OpenSegmentedIndex(dir, search.DefaultFieldBoosts, log)
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected a missing index, got %v", err)
+	}
+	docs := make([]*search.DocSummary, 200)
+	live := make(map[string]bool)
+	for i := range docs {
+		text := fmt.Sprintf("common word%d group%d", i, i%10)
+		docs[i] = search.NewDocSummary(text, fmt.Sprint(i), fmt.Sprint(i), search.Text)
+		if err := index.InsertDoc(docs[i], int64(i)); err != nil {
+			t.Fatal(err)
+		}
+		live[docs[i].DocID] = true
+		// removals and replacements spread over segments that get merged
+		if i%3 == 2 {
+			if err := index.RemoveDoc(docs[i-1], int64(i)); err != nil {
+				t.Fatal(err)
+			}
+			live[docs[i-1].DocID] = false
+		}
+		if i%7 == 6 {
+			if err := index.InsertDoc(docs[i-5], int64(i)); err != nil {
+				t.Fatal(err)
+			}
+			live[docs[i-5].DocID] = true
+		}
+	}
+	index.Close()
+
+	check := func(index *SegmentedIndex) {
+		t.Helper()
+		var expected []string
+		for docID, ok := range live {
+			if ok {
+				expected = append(expected, docID)
+			}
+		}
+		found := index.SearchTokens([]string{"common"})
+		slices.Sort(expected)
+		slices.Sort(found)
+		if !slices.Equal(found, expected) {
+			t.Errorf("found %d documents, expected %d", len(found), len(expected))
+		}
+		counter := index.Counter()
+		if counter.NumDocs != len(expected) || counter.DocCounts["common"] != len(expected) || counter.Ts != 199 {
+			t.Errorf("unexpected counter %d, %d, %d", counter.NumDocs, counter.DocCounts["common"], counter.Ts)
+		}
+		expectedCounts := map[string]int{}
+		for i, doc := range docs {
+			if live[doc.DocID] {
+				expectedCounts[fmt.Sprintf("group%d", i%10)]++
+			}
+		}
+		for token, count := range expectedCounts {
+			if counter.DocCounts[token] != count {
+				t.Errorf("%s in %d documents, expected %d", token, counter.DocCounts[token], count)
+			}
+		}
+	}
+	check(index)
+	if len(index.segments) > 2*mergeFactor {
+		t.Errorf("%d segments left after merging", len(index.segments))
+	}
+
+	reopened, err := OpenSegmentedIndex(dir, search.DefaultFieldBoosts, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reopened)
+	files, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(files) != len(reopened.segments) {
+		t.Errorf("%d segment files for %d segments", len(files), len(reopened.segments))
+	}
+
+	docsIndex := NewInvertedIndex()
+	docsIndex.InsertDoc(docs[0], search.DefaultFieldBoosts, 300)
+	if err := reopened.Reset(docsIndex, 300); err != nil {
+		t.Fatal(err)
+	}
+	live = map[string]bool{docs[0].DocID: true}
+	if found := reopened.SearchTokens([]string{"common"}); !slices.Equal(found, slices.Collect(maps.Keys(live))) {
+		t.Errorf("found %v after reset", found)
+	}
+}
+
+func TestSegmentedIndexReplaceCounts(t *testing.T) {
+	index, err := OpenSegmentedIndex(t.TempDir(), search.DefaultFieldBoosts, logger.NewDefaultLogger())
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected a missing index, got %v", err)
+	}
+	defer index.Close()
+	for i, text := range []string{"kestrel shared", "falcon shared", "heron"} {
+		doc := search.NewDocSummary(text, fmt.Sprint(i), fmt.Sprint(i), search.Text)
+		if err := index.InsertDoc(doc, int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the new version of document 1 drops falcon and shared
+	replaced := search.NewDocSummary("osprey heron", "1", "1", search.Text)
+	if err := index.InsertDoc(replaced, 3); err != nil {
+		t.Fatal(err)
+	}
+	counter := index.Counter()
+	got := maps.Clone(counter.DocCounts)
+	expected := map[string]int{"kestrel": 1, "shared": 1, "osprey": 1, "heron": 2}
+	if !maps.Equal(got, expected) || counter.NumDocs != 3 || counter.Ts != 3 {
+		t.Errorf("counts %v of %d documents at %d, expected %v of 3 at 3", got, counter.NumDocs, counter.Ts, expected)
+	}
+	index.countDocs()
+	if !maps.Equal(counter.DocCounts, got) {
+		t.Errorf("counts %v after replacing, %v when recounted", got, counter.DocCounts)
+	}
+}
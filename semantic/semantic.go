@@ -0,0 +1,196 @@
+// Package semantic embeds texts as dense vectors, so that documents can be
+// found by meaning rather than by exact tokens.
+//
+// Texts are embedded with static word vectors averaged with smooth inverse
+// frequency weights, not with a sentence-embedding model: GGUF and ONNX
+// models need a native inference runtime, which this package does without.
+// Word order is ignored, so the vectors are coarser than those of a sentence
+// model, but any word2vec, GloVe or fastText file can be used.
+package semantic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"DocuStore/search"
+)
+
+// smoothing of the smooth inverse frequency weights, as in Arora et al.
+const sifSmoothing = 1e-3
+
+// Embedder computes dense vectors of unit length for texts.
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+	Dimensions() int
+	// Name is the name of the model shown to the user
+	Name() string
+	// ID identifies the model by its content, vectors of different models
+	// are not comparable
+	ID() string
+}
+
+// WordVectors is a static embedding model with a vector per word, read from
+// the text format of word2vec, GloVe and fastText (.vec) files. A text is
+// embedded as the weighted mean of the vectors of its words.
+type WordVectors struct {
+	name    string
+	id      string
+	dims    int
+	vectors map[string][]float32
+	weights map[string]float32
+}
+
+// LoadWordVectors reads a model file, optionally gzip compressed. Words are
+// expected from most to least frequent, as in the published models, which is
+// used to weigh down common words.
+func LoadWordVectors(path string) (*WordVectors, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	hashed := io.TeeReader(file, hash)
+	r := hashed
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(hashed)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	model := &WordVectors{
+		name:    filepath.Base(path),
+		vectors: make(map[string][]float32),
+	}
+	var words []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if line == 1 && len(fields) == 2 {
+			// word2vec and fastText header: number of words and dimensions
+			continue
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		if model.dims == 0 {
+			model.dims = len(fields) - 1
+		}
+		if len(fields)-1 != model.dims {
+			return nil, fmt.Errorf("%s:%d: expected %d dimensions, got %d", path, line, model.dims, len(fields)-1)
+		}
+		vector := make([]float32, model.dims)
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseFloat(field, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			vector[i] = float32(value)
+		}
+		// models may be cased, keep the most frequent form of each token
+		tokens := search.Tokenize(fields[0])
+		if len(tokens) != 1 {
+			continue
+		}
+		if _, ok := model.vectors[tokens[0]]; ok {
+			continue
+		}
+		model.vectors[tokens[0]] = vector
+		words = append(words, tokens[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("no word vectors in " + path)
+	}
+	// the whole file is hashed, even after the end of a gzip stream
+	_, err = io.Copy(io.Discard, hashed)
+	if err != nil {
+		return nil, err
+	}
+	model.id = hex.EncodeToString(hash.Sum(nil))
+
+	// word frequencies follow Zipf's law, p(rank) ~ 1 / (rank * ln(n))
+	model.weights = make(map[string]float32, len(words))
+	logN := math.Log(float64(len(words)) + 1)
+	for rank, word := range words {
+		p := 1 / (float64(rank+1) * logN)
+		model.weights[word] = float32(sifSmoothing / (sifSmoothing + p))
+	}
+	return model, nil
+}
+
+func (m *WordVectors) Dimensions() int {
+	return m.dims
+}
+
+func (m *WordVectors) Name() string {
+	return m.name
+}
+
+// ID is the SHA-256 hash of the model file, so that a model is recognized
+// when its file is moved or renamed, and not when it is replaced.
+func (m *WordVectors) ID() string {
+	return m.id
+}
+
+// Embed returns the normalized mean of the vectors of the words of text,
+// weighted by smooth inverse frequency. Unknown words are ignored, a text
+// without known words has a zero vector.
+func (m *WordVectors) Embed(text string) ([]float32, error) {
+	embedding := make([]float32, m.dims)
+	for _, token := range search.Tokenize(text) {
+		vector, ok := m.vectors[token]
+		if !ok {
+			continue
+		}
+		weight := m.weights[token]
+		for i, value := range vector {
+			embedding[i] += weight * value
+		}
+	}
+	Normalize(embedding)
+	return embedding, nil
+}
+
+// Normalize scales vector to unit length, leaving zero vectors unchanged.
+func Normalize(vector []float32) {
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+}
+
+// Similarity returns the cosine similarity of two vectors of unit length.
+func Similarity(a []float32, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
@@ -0,0 +1,78 @@
+package semantic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testVectors = `6 3
+the 0.3 0.3 0.3
+Car 1 0.1 0
+car 0.9 0.9 0.9
+automobile 0.95 0.15 0.05
+banana 0 1 0.1
+fruit 0.05 0.95 0.1
+`
+
+func TestWordVectors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.vec")
+	err := os.WriteFile(path, []byte(testVectors), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := LoadWordVectors(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Dimensions() != 3 {
+		t.Fatalf("expected 3 dimensions, got %d", model.Dimensions())
+	}
+	// the first, most frequent form of a word wins
+	if model.vectors["car"][0] != 1 {
+		t.Errorf("unexpected vector for car: %v", model.vectors["car"])
+	}
+
+	embed := func(text string) []float32 {
+		vector, err := model.Embed(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vector
+	}
+	car, automobile, banana := embed("the car"), embed("an Automobile!"), embed("banana fruit")
+	if Similarity(car, automobile) <= Similarity(car, banana) {
+		t.Errorf("car is closer to banana (%f) than to automobile (%f)", Similarity(car, banana), Similarity(car, automobile))
+	}
+	if similarity := Similarity(car, car); similarity < 0.999 || similarity > 1.001 {
+		t.Errorf("embedding is not normalized: %f", similarity)
+	}
+	if Similarity(embed("unknown words"), car) != 0 {
+		t.Error("text without known words should have a zero vector")
+	}
+}
+
+func TestModelID(t *testing.T) {
+	dir := t.TempDir()
+	load := func(name string, content string) *WordVectors {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		model, err := LoadWordVectors(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return model
+	}
+	model := load("vectors.vec", testVectors)
+	copied := load("copy.vec", testVectors)
+	changed := load("vectors.txt", testVectors+"apple 0.1 0.9 0.2\n")
+	if model.ID() != copied.ID() || model.Name() == copied.Name() {
+		t.Errorf("copies of a model: %s %s, %s %s", model.Name(), model.ID(), copied.Name(), copied.ID())
+	}
+	if model.ID() == changed.ID() {
+		t.Error("different models have the same ID")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"DocuStore/scraper"
+)
+
+const defaultServerAddr = "127.0.0.1:7331"
+
+// maximum size of a request body, large enough for long Markdown documents
+const maxRequestSize = 32 << 20
+
+// apiServer exposes the engine over a local REST/JSON API.
+type apiServer struct {
+	engine *DocuEngine
+	token  string
+}
+
+// Serve runs the API on addr, which must be a loopback address, until the
+// server fails or ctx is done. Every request must carry the token as a
+// bearer token.
+func (e *DocuEngine) Serve(ctx context.Context, addr string, token string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("refusing to listen on non-loopback address %s", addr)
+	}
+	if token == "" {
+		return errors.New("an API token is required")
+	}
+
+	s := &apiServer{engine: e, token: token}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	e.log.Info(fmt.Sprintf("serving API on http://%s", addr))
+	stop := context.AfterFunc(ctx, func() {
+		server.Shutdown(context.Background())
+	})
+	defer stop()
+	err = server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// apiToken returns the token stored in the data folder, creating it on first
+// use.
+func (e *DocuEngine) apiToken() (string, error) {
+	tokenPath := filepath.Join(e.dataFolder, "api-token")
+	content, err := os.ReadFile(tokenPath)
+	if err == nil && len(strings.TrimSpace(string(content))) > 0 {
+		return strings.TrimSpace(string(content)), nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var buffer [32]byte
+	_, err = rand.Read(buffer[:])
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buffer[:])
+	err = os.WriteFile(tokenPath, []byte(token+"\n"), 0600)
+	return token, err
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/documents/url", s.addURL)
+	mux.HandleFunc("POST /api/documents/text", s.addText)
+	mux.HandleFunc("GET /api/documents", s.listDocuments)
+	mux.HandleFunc("GET /api/documents/{id}", s.readDocument)
+	mux.HandleFunc("DELETE /api/documents/{id}", s.deleteDocument)
+	mux.HandleFunc("POST /api/documents/{id}/tags", s.addTags)
+	mux.HandleFunc("DELETE /api/documents/{id}/tags/{tag}", s.removeTag)
+	mux.HandleFunc("GET /api/search", s.search)
+	return s.authenticate(mux)
+}
+
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid API token"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *apiServer) addURL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL string `json:"url"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	docID, err := s.engine.AddURL(r.Context(), strings.TrimSpace(req.URL))
+	writeAdded(w, docID, err)
+}
+
+func (s *apiServer) addText(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text  string `json:"text"`
+		Title string `json:"title"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	docID, err := s.engine.AddText(strings.TrimSpace(req.Text), strings.TrimSpace(req.Title))
+	writeAdded(w, docID, err)
+}
+
+func (s *apiServer) listDocuments(w http.ResponseWriter, r *http.Request) {
+	docs, err := s.engine.ListDocuments(r.URL.Query().Get("tag"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, docs)
+}
+
+func (s *apiServer) readDocument(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("id")
+	info, err := s.engine.DocumentInfo(docID)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	content, err := s.engine.LoadText(docID)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		*DocumentInfo
+		Content string
+	}{info, content})
+}
+
+func (s *apiServer) deleteDocument(w http.ResponseWriter, r *http.Request) {
+	err := s.engine.DeleteDocument(r.PathValue("id"))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) addTags(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	err := s.engine.TagDocument(r.PathValue("id"), req.Tags...)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) removeTag(w http.ResponseWriter, r *http.Request) {
+	err := s.engine.UntagDocument(r.PathValue("id"), r.PathValue("tag"))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing query parameter q"))
+		return
+	}
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+		limit = n
+	}
+	results, err := s.engine.QueryDocument(r.Context(), query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeAdded answers a request adding a document. Documents already in the
+// collection are not an error.
+func writeAdded(w http.ResponseWriter, docID string, err error) {
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		writeJSON(w, http.StatusOK, map[string]string{"id": docID})
+	case err != nil:
+		writeError(w, engineErrorStatus(err, http.StatusUnprocessableEntity), err)
+	default:
+		writeJSON(w, http.StatusCreated, map[string]string{"id": docID})
+	}
+}
+
+func writeEngineError(w http.ResponseWriter, err error) {
+	writeError(w, engineErrorStatus(err, http.StatusInternalServerError), err)
+}
+
+// engineErrorStatus returns the HTTP status of an engine error, or fallback
+// for errors without a specific status.
+func engineErrorStatus(err error, fallback int) int {
+	var fetchErr *scraper.FetchError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNearDuplicate):
+		return http.StatusConflict
+	case errors.Is(err, ErrEmptyContent), errors.Is(err, ErrEmptyTitle):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &fetchErr):
+		return http.StatusBadGateway
+	}
+	return fallback
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"DocuStore/scraper"
+	"DocuStore/search"
+)
+
+const testToken = "secret"
+
+// apiRequest sends a request with the test token and decodes the JSON answer
+// into v, if not nil. It returns the status code.
+func apiRequest(t *testing.T, server *httptest.Server, method string, path string, body string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if v != nil {
+		err = json.NewDecoder(res.Body).Decode(v)
+		if err != nil {
+			t.Fatalf("%s %s: %s", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	engine := openTestEngine(t)
+	server := httptest.NewServer((&apiServer{engine: engine, token: testToken}).routes())
+	defer server.Close()
+
+	for _, header := range []string{"", "Bearer wrong", "Bearer " + testToken + "x", testToken, "Basic " + testToken} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/documents", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "error") {
+			t.Errorf("authorization %q: status %d, %s", header, res.StatusCode, body)
+		}
+	}
+	var docs []*DocumentInfo
+	if status := apiRequest(t, server, http.MethodGet, "/api/documents", "", &docs); status != http.StatusOK {
+		t.Errorf("status %d with the token", status)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	engine := openTestEngine(t)
+	server := httptest.NewServer((&apiServer{engine: engine, token: testToken}).routes())
+	defer server.Close()
+
+	var added map[string]string
+	status := apiRequest(t, server, http.MethodPost, "/api/documents/text", `{"text": "  # Spark\nTune the executors.  ", "title": ""}`, &added)
+	docID := added["id"]
+	if status != http.StatusCreated || docID == "" {
+		t.Fatalf("adding a note: status %d, %v", status, added)
+	}
+	var doc struct {
+		DocumentInfo
+		Content string
+	}
+	status = apiRequest(t, server, http.MethodGet, "/api/documents/"+docID, "", &doc)
+	if status != http.StatusOK || doc.Title != "Spark" || doc.Content != "# Spark\nTune the executors." {
+		t.Errorf("reading the note: status %d, %+v", status, doc)
+	}
+	status = apiRequest(t, server, http.MethodPost, "/api/documents/text", `{"text": "# Spark\nTune the executors."}`, &added)
+	if status != http.StatusOK || added["id"] != docID {
+		t.Errorf("adding the note again: status %d, %v", status, added)
+	}
+
+	var results []*search.SearchResult
+	status = apiRequest(t, server, http.MethodGet, "/api/search?q=executors&limit=5", "", &results)
+	if status != http.StatusOK || len(results) != 1 || results[0].DocID != docID {
+		t.Errorf("searching: status %d, %v", status, results)
+	}
+
+	status = apiRequest(t, server, http.MethodPost, "/api/documents/"+docID+"/tags", `{"tags": ["spark", "perf"]}`, nil)
+	if status != http.StatusNoContent {
+		t.Errorf("tagging: status %d", status)
+	}
+	var docs []*DocumentInfo
+	apiRequest(t, server, http.MethodGet, "/api/documents?tag=perf", "", &docs)
+	if len(docs) != 1 || docs[0].DocID != docID {
+		t.Errorf("documents tagged perf: %v", docs)
+	}
+	status = apiRequest(t, server, http.MethodDelete, "/api/documents/"+docID+"/tags/perf", "", nil)
+	if status != http.StatusNoContent {
+		t.Errorf("untagging: status %d", status)
+	}
+	apiRequest(t, server, http.MethodGet, "/api/documents?tag=perf", "", &docs)
+	if len(docs) != 0 {
+		t.Errorf("documents tagged perf after untagging: %v", docs)
+	}
+
+	status = apiRequest(t, server, http.MethodDelete, "/api/documents/"+docID, "", nil)
+	if status != http.StatusNoContent {
+		t.Errorf("deleting: status %d", status)
+	}
+	apiRequest(t, server, http.MethodGet, "/api/search?q=executors", "", &results)
+	if len(results) != 0 {
+		t.Errorf("deleted note found: %v", results)
+	}
+
+	pages := httptest.NewServer(http.NotFoundHandler())
+	defer pages.Close()
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/api/documents/" + docID, "", http.StatusNotFound},
+		{http.MethodDelete, "/api/documents/" + docID, "", http.StatusNotFound},
+		{http.MethodPost, "/api/documents/text", `{"text": "   "}`, http.StatusUnprocessableEntity},
+		{http.MethodPost, "/api/documents/text", `{"text": `, http.StatusBadRequest},
+		{http.MethodPost, "/api/documents/url", fmt.Sprintf(`{"url": "%s/missing"}`, pages.URL), http.StatusBadGateway},
+		{http.MethodGet, "/api/search", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/search?q=spark&limit=0", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/search?q=spark&limit=x", "", http.StatusBadRequest},
+		{http.MethodPut, "/api/documents/text", "{}", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		status := apiRequest(t, server, c.method, c.path, c.body, nil)
+		if status != c.status {
+			t.Errorf("%s %s: status %d, expected %d", c.method, c.path, status, c.status)
+		}
+	}
+}
+
+func TestEngineErrorStatus(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{fmt.Errorf("%w: abc", ErrNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: a title", ErrNearDuplicate), http.StatusConflict},
+		{ErrEmptyContent, http.StatusUnprocessableEntity},
+		{ErrEmptyTitle, http.StatusUnprocessableEntity},
+		{&scraper.FetchError{URL: "https://example.com", StatusCode: 500, Status: "500 Internal Server Error"}, http.StatusBadGateway},
+		{errors.New("disk full"), http.StatusTeapot},
+	}
+	for _, c := range cases {
+		if status := engineErrorStatus(c.err, http.StatusTeapot); status != c.status {
+			t.Errorf("%v: status %d, expected %d", c.err, status, c.status)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+// Neighbor is a document found near a query vector.
+type Neighbor struct {
+	DocID      string
+	Similarity float32
+}
+
+// VectorIndex finds the documents whose vectors are most similar to a query.
+// Vectors must have unit length.
+type VectorIndex interface {
+	Insert(docID string, vector []float32)
+	Delete(docID string)
+	// Search returns up to k neighbors, most similar first.
+	Search(query []float32, k int) []Neighbor
+	Vector(docID string) []float32
+	Len() int
+}
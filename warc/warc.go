@@ -0,0 +1,205 @@
+// Package warc reads and writes Web ARChive (WARC) files, as produced by
+// wget --warc-file and most web archivers.
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const version = "WARC/1.1"
+
+// Record types
+const (
+	Warcinfo = "warcinfo"
+	Response = "response"
+	Resource = "resource"
+	Request  = "request"
+	Metadata = "metadata"
+)
+
+// header fields written first, in this order and with this capitalization
+var headerOrder = []string{
+	"WARC-Type",
+	"WARC-Record-ID",
+	"WARC-Date",
+	"WARC-Target-URI",
+	"WARC-Filename",
+	"Content-Type",
+	"Content-Length",
+}
+
+// Record is a single WARC record. Header keys are canonicalized, so access
+// them with Header.Get and Header.Set.
+type Record struct {
+	Header  textproto.MIMEHeader
+	Content []byte
+}
+
+// NewRecord creates a record of the given type.
+func NewRecord(recordType string) *Record {
+	rec := &Record{Header: make(textproto.MIMEHeader)}
+	rec.Header.Set("WARC-Type", recordType)
+	return rec
+}
+
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+func (r *Record) TargetURI() string {
+	// some writers wrap the URI in angle brackets
+	return strings.Trim(r.Header.Get("WARC-Target-URI"), "<>")
+}
+
+func (r *Record) ContentType() string {
+	return r.Header.Get("Content-Type")
+}
+
+// Date returns the WARC-Date of the record, or the zero time if it is
+// missing or invalid.
+func (r *Record) Date() time.Time {
+	date, err := time.Parse(time.RFC3339Nano, r.Header.Get("WARC-Date"))
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+// Reader reads records from a WARC file, compressed or not.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader creates a Reader, detecting gzip compression.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// each record is usually its own gzip member, read them all as one stream
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF when there are no more records.
+func (r *Reader) Next() (*Record, error) {
+	var line string
+	// skip the blank lines that end the previous record
+	for line == "" {
+		raw, err := r.r.ReadString('\n')
+		line = strings.TrimRight(raw, "\r\n")
+		if line == "" && err != nil {
+			return nil, err
+		}
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("invalid WARC record version line: %q", line)
+	}
+
+	header, err := textproto.NewReader(r.r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid WARC Content-Length: %q", header.Get("Content-Length"))
+	}
+	content := make([]byte, length)
+	_, err = io.ReadFull(r.r, content)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &Record{Header: header, Content: content}, nil
+}
+
+// Writer writes records to a WARC file.
+type Writer struct {
+	w        io.Writer
+	compress bool
+}
+
+// NewWriter creates a Writer. If compress is true every record is written as
+// its own gzip member, as expected from .warc.gz files.
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, compress: compress}
+}
+
+// WriteRecord writes rec, filling in its Content-Length and, if missing, its
+// WARC-Record-ID and WARC-Date.
+func (w *Writer) WriteRecord(rec *Record) error {
+	if rec.Header.Get("WARC-Type") == "" {
+		return errors.New("WARC record without type")
+	}
+	if rec.Header.Get("WARC-Record-ID") == "" {
+		id, err := newRecordID()
+		if err != nil {
+			return err
+		}
+		rec.Header.Set("WARC-Record-ID", id)
+	}
+	if rec.Header.Get("WARC-Date") == "" {
+		rec.Header.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+	}
+	rec.Header.Set("Content-Length", strconv.Itoa(len(rec.Content)))
+
+	var buffer bytes.Buffer
+	buffer.WriteString(version + "\r\n")
+	written := make(map[string]bool)
+	for _, name := range headerOrder {
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		for _, value := range rec.Header[key] {
+			fmt.Fprintf(&buffer, "%s: %s\r\n", name, value)
+		}
+		written[key] = true
+	}
+	for key, values := range rec.Header {
+		if written[key] {
+			continue
+		}
+		for _, value := range values {
+			fmt.Fprintf(&buffer, "%s: %s\r\n", key, value)
+		}
+	}
+	buffer.WriteString("\r\n")
+	buffer.Write(rec.Content)
+	buffer.WriteString("\r\n\r\n")
+
+	if !w.compress {
+		_, err := w.w.Write(buffer.Bytes())
+		return err
+	}
+	gz := gzip.NewWriter(w.w)
+	_, err := gz.Write(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func newRecordID() (string, error) {
+	var uuid [16]byte
+	_, err := rand.Read(uuid[:])
+	if err != nil {
+		return "", err
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40 // version 4
+	uuid[8] = uuid[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
@@ -0,0 +1,43 @@
+package warc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var buffer bytes.Buffer
+		writer := NewWriter(&buffer, compress)
+		for _, uri := range []string{"https://example.com/a", "https://example.com/b"} {
+			record := NewRecord(Resource)
+			record.Header.Set("WARC-Target-URI", uri)
+			record.Header.Set("Content-Type", "text/html")
+			record.Content = []byte("<html><title>" + uri + "</title></html>")
+			if err := writer.WriteRecord(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		reader, err := NewReader(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, uri := range []string{"https://example.com/a", "https://example.com/b"} {
+			record, err := reader.Next()
+			if err != nil {
+				t.Fatalf("compress=%v: %s", compress, err)
+			}
+			if record.Type() != Resource || record.TargetURI() != uri {
+				t.Errorf("compress=%v: got %s record for %s", compress, record.Type(), record.TargetURI())
+			}
+			if string(record.Content) != "<html><title>"+uri+"</title></html>" {
+				t.Errorf("compress=%v: unexpected content %q", compress, record.Content)
+			}
+		}
+		if _, err := reader.Next(); err != io.EOF {
+			t.Errorf("compress=%v: expected io.EOF, got %v", compress, err)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// how long to wait for a burst of file events to settle before syncing
+const watchDebounce = time.Second
+
+// how often watched folders are rescanned when file events are unavailable
+const watchPollInterval = 30 * time.Second
+
+// file extensions indexed in watched folders
+var watchedExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+}
+
+// watchedFile is the state of a file the last time it was indexed.
+type watchedFile struct {
+	path   string
+	folder string
+	mtime  int64
+	hash   string
+	docID  string // empty if the file could not be indexed
+}
+
+// AddWatchedFolder starts tracking a folder, indexing its notes right away.
+func (e *DocuEngine) AddWatchedFolder(ctx context.Context, folder string) error {
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(folder)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a folder: %s", folder)
+	}
+	// a file is tracked by a single folder
+	folders, err := ListWatchedFolders(e.db)
+	if err != nil {
+		return err
+	}
+	for _, watched := range folders {
+		if watched != folder && (isWithin(folder, watched) || isWithin(watched, folder)) {
+			return fmt.Errorf("%s overlaps the watched folder %s", folder, watched)
+		}
+	}
+	err = InsertWatchedFolder(e.db, folder)
+	if err != nil {
+		return err
+	}
+	e.watchLock.Lock()
+	defer e.watchLock.Unlock()
+	return e.syncFolder(ctx, folder)
+}
+
+// RemoveWatchedFolder stops tracking a folder. Documents already indexed from
+// it are kept.
+func (e *DocuEngine) RemoveWatchedFolder(folder string) error {
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return err
+	}
+	return DeleteWatchedFolder(e.db, folder)
+}
+
+func (e *DocuEngine) ListWatchedFolders() ([]string, error) {
+	return ListWatchedFolders(e.db)
+}
+
+// SyncWatchedFolders brings the index up to date with the watched folders:
+// new and modified notes are indexed and deleted ones removed. Cancelling ctx
+// stops at the next note.
+func (e *DocuEngine) SyncWatchedFolders(ctx context.Context) error {
+	e.watchLock.Lock()
+	defer e.watchLock.Unlock()
+	folders, err := ListWatchedFolders(e.db)
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		err = e.syncFolder(ctx, folder)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			e.log.Warning(fmt.Sprintf("error syncing watched folder %s: %s", folder, err))
+		}
+	}
+	return nil
+}
+
+// isWithin reports whether path is folder or is inside it.
+func isWithin(path string, folder string) bool {
+	rel, err := filepath.Rel(folder, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (e *DocuEngine) syncFolder(ctx context.Context, folder string) error {
+	known, err := LoadWatchedFiles(e.db, folder)
+	if err != nil {
+		return err
+	}
+	// watched folders nested in this one, left from before overlapping
+	// folders were refused, keep their own files
+	folders, err := ListWatchedFolders(e.db)
+	if err != nil {
+		return err
+	}
+	nested := make(map[string]bool)
+	for _, watched := range folders {
+		nested[watched] = watched != folder && isWithin(watched, folder)
+	}
+
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			e.log.Warning(fmt.Sprintf("error reading %s: %s", path, err))
+			return nil
+		}
+		if path != folder && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && nested[path] {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !watchedExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		seen[path] = true
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		previous, ok := known[path]
+		if ok && previous.mtime == info.ModTime().UnixNano() {
+			return nil
+		}
+		err = e.syncFile(folder, path, info.ModTime().UnixNano(), previous)
+		if err != nil {
+			e.log.Warning(fmt.Sprintf("error indexing %s: %s", path, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for path, file := range known {
+		if seen[path] || inNestedFolder(path, nested) {
+			continue
+		}
+		e.log.Info(fmt.Sprintf("removing deleted note %s", path))
+		err = e.releaseDocument(file.docID, path)
+		if err != nil {
+			return err
+		}
+		err = DeleteWatchedFile(e.db, path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inNestedFolder reports whether path is inside one of the nested folders.
+func inNestedFolder(path string, nested map[string]bool) bool {
+	for folder, ok := range nested {
+		if ok && isWithin(path, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncFile indexes a new or modified note, replacing the document of its
+// previous version.
+func (e *DocuEngine) syncFile(folder string, path string, mtime int64, previous *watchedFile) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(content)
+	file := &watchedFile{path: path, folder: folder, mtime: mtime, hash: hex.EncodeToString(hash[:])}
+
+	if previous != nil && previous.hash == file.hash {
+		// touched but not modified
+		file.docID = previous.docID
+		return UpsertWatchedFile(e.db, file)
+	}
+
+	if previous != nil {
+		// removed first, so that the new version is not taken for a near-duplicate
+		err = e.releaseDocument(previous.docID, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	e.log.Info(fmt.Sprintf("indexing note %s", path))
+	text := strings.TrimSpace(string(content))
+	if text != "" {
+		file.docID, err = e.addTextFile(text, path)
+		// notes with the same content share a document
+		if err != nil && !errors.Is(err, ErrDuplicate) {
+			e.log.Warning(fmt.Sprintf("error indexing %s: %s", path, err))
+		}
+	}
+	return UpsertWatchedFile(e.db, file)
+}
+
+// releaseDocument deletes a document that came from the watched file at
+// path, unless another watched file has the same content.
+func (e *DocuEngine) releaseDocument(docID string, path string) error {
+	if docID == "" {
+		return nil
+	}
+	used, err := IsWatchedDocument(e.db, docID, path)
+	if err != nil || used {
+		return err
+	}
+	err = e.DeleteDocument(docID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// WatchFolders keeps the watched folders in sync until ctx is done. File
+// system events are used when available, otherwise folders are polled.
+func (e *DocuEngine) WatchFolders(ctx context.Context) {
+	resync := func() {
+		err := e.SyncWatchedFolders(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.log.Warning(fmt.Sprintf("error syncing watched folders: %s", err))
+		}
+	}
+	resync()
+
+	watcher, err := e.newFolderWatcher()
+	if err != nil {
+		e.log.Warning(fmt.Sprintf("file events unavailable, polling watched folders: %s", err))
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				resync()
+			}
+		}
+	}
+	defer watcher.Close()
+
+	// watched folders may be added while running, rescan them once in a while
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					e.watchTree(watcher, event.Name)
+				}
+			}
+			debounce.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			e.log.Warning(fmt.Sprintf("file watcher error: %s", err))
+		case <-debounce.C:
+			resync()
+		case <-ticker.C:
+			e.watchAll(watcher)
+			resync()
+		}
+	}
+}
+
+func (e *DocuEngine) newFolderWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	err = e.watchAll(watcher)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// watchAll adds every watched folder and its subfolders to watcher, which
+// does not watch recursively.
+func (e *DocuEngine) watchAll(watcher *fsnotify.Watcher) error {
+	folders, err := ListWatchedFolders(e.db)
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		err = e.watchTree(watcher, folder)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *DocuEngine) watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeNote(t *testing.T, path string, text string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(text), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// documentTitles returns the titles of the stored documents.
+func documentTitles(t *testing.T, engine *DocuEngine) []string {
+	t.Helper()
+	docs, err := engine.ListDocuments("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, doc := range docs {
+		titles = append(titles, doc.Title)
+	}
+	return titles
+}
+
+func TestSyncFolder(t *testing.T) {
+	ctx := context.Background()
+	engine := openTestEngine(t)
+	folder := t.TempDir()
+	writeNote(t, filepath.Join(folder, "spark.md"), "# Spark\nexecutor memory")
+	writeNote(t, filepath.Join(folder, "sub", "kafka.txt"), "kafka partitions")
+	writeNote(t, filepath.Join(folder, "copy.txt"), "kafka partitions")
+	writeNote(t, filepath.Join(folder, "main.go"), "package main")
+	writeNote(t, filepath.Join(folder, ".hidden", "secret.md"), "hidden note")
+
+	err := engine.AddWatchedFolder(ctx, folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := documentTitles(t, engine)
+	if len(titles) != 2 {
+		t.Fatalf("documents %q after adding the folder", titles)
+	}
+
+	// modified note, with a later modification time
+	later := time.Now().Add(time.Minute)
+	writeNote(t, filepath.Join(folder, "spark.md"), "# Spark tuning\nexecutor cores")
+	os.Chtimes(filepath.Join(folder, "spark.md"), later, later)
+	writeNote(t, filepath.Join(folder, "new.md"), "# New\na new note")
+	err = engine.SyncWatchedFolders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(documentTitles(t, engine), ",") + ","
+	if !strings.Contains(joined, "Spark tuning,") || strings.Contains(joined, "Spark,") || !strings.Contains(joined, "New,") {
+		t.Errorf("documents %q after modifying notes", joined)
+	}
+	results, err := engine.QueryDocument(ctx, "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("previous version of a note found: %v", results)
+	}
+
+	// a note sharing its document with another one keeps it
+	err = os.Remove(filepath.Join(folder, "copy.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SyncWatchedFolders(ctx)
+	if results, _ := engine.QueryDocument(ctx, "partitions"); len(results) != 1 {
+		t.Errorf("%d documents for a note still in the folder", len(results))
+	}
+	err = os.RemoveAll(filepath.Join(folder, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SyncWatchedFolders(ctx)
+	if results, _ := engine.QueryDocument(ctx, "partitions"); len(results) != 0 {
+		t.Errorf("deleted note found: %v", results)
+	}
+	if titles := documentTitles(t, engine); len(titles) != 2 {
+		t.Errorf("documents %q after deleting notes", titles)
+	}
+}
+
+func TestNestedWatchedFolders(t *testing.T) {
+	ctx := context.Background()
+	engine := openTestEngine(t)
+	folder := t.TempDir()
+	sub := filepath.Join(folder, "sub")
+	writeNote(t, filepath.Join(folder, "top.md"), "top note")
+	writeNote(t, filepath.Join(sub, "inner.md"), "inner note")
+
+	err := engine.AddWatchedFolder(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = engine.AddWatchedFolder(ctx, folder); err == nil {
+		t.Error("added a folder containing a watched folder")
+	}
+	if err = engine.AddWatchedFolder(ctx, filepath.Join(sub, ".")); err != nil {
+		t.Errorf("adding a watched folder again returned %v", err)
+	}
+	writeNote(t, filepath.Join(sub, "deeper", "deep.md"), "deep note")
+	if err = engine.AddWatchedFolder(ctx, filepath.Join(sub, "deeper")); err == nil {
+		t.Error("added a folder inside a watched folder")
+	}
+
+	// overlapping folders watched before they were refused
+	err = InsertWatchedFolder(engine.db, folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = engine.SyncWatchedFolders(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for watched, count := range map[string]int{folder: 1, sub: 2} {
+			files, err := LoadWatchedFiles(engine.db, watched)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != count {
+				t.Errorf("sync %d: %d files in %s, expected %d", i, len(files), watched, count)
+			}
+		}
+	}
+	if titles := documentTitles(t, engine); len(titles) != 3 {
+		t.Errorf("documents %q", titles)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"DocuStore/warc"
+)
+
+// ImportWARC adds the HTML pages archived in a WARC file as URL documents,
+// without accessing the network. It returns the number of pages added and of
+// pages that were already stored, also when ctx is cancelled.
+func (e *DocuEngine) ImportWARC(ctx context.Context, path string, collection string) (added int, duplicates int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	reader, err := warc.NewReader(f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return added, duplicates, ctx.Err()
+		}
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return added, duplicates, err
+		}
+		html, err := warcHTML(record)
+		if err != nil {
+			e.log.Debug(fmt.Sprintf("skipping WARC record for %s: %s", record.TargetURI(), err))
+			continue
+		}
+		docID, err := e.AddHTML(ctx, html, record.TargetURI())
+		if err != nil && !errors.Is(err, ErrDuplicate) {
+			e.log.Warning(fmt.Sprintf("error adding %s: %s", record.TargetURI(), err))
+			continue
+		}
+		if err == nil {
+			added++
+		} else {
+			duplicates++
+		}
+		if collection != "" {
+			err = AddToCollection(e.db, collection, docID)
+			if err != nil {
+				return added, duplicates, err
+			}
+		}
+	}
+	return added, duplicates, nil
+}
+
+// warcHTML returns the HTML page stored in a response or resource record.
+func warcHTML(record *warc.Record) ([]byte, error) {
+	if record.TargetURI() == "" {
+		return nil, errors.New("no target URI")
+	}
+	switch record.Type() {
+	case warc.Resource:
+		if !isHTML(record.ContentType()) {
+			return nil, fmt.Errorf("not HTML: %s", record.ContentType())
+		}
+		return record.Content, nil
+	case warc.Response:
+		if !strings.HasPrefix(record.ContentType(), "application/http") {
+			return nil, fmt.Errorf("not an HTTP response: %s", record.ContentType())
+		}
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(record.Content)), nil)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status: %s", response.Status)
+		}
+		if !isHTML(response.Header.Get("Content-Type")) {
+			return nil, fmt.Errorf("not HTML: %s", response.Header.Get("Content-Type"))
+		}
+		var body io.Reader = response.Body
+		if strings.EqualFold(response.Header.Get("Content-Encoding"), "gzip") {
+			gz, err := gzip.NewReader(response.Body)
+			if err != nil {
+				return nil, err
+			}
+			defer gz.Close()
+			body = gz
+		}
+		return io.ReadAll(body)
+	default:
+		return nil, fmt.Errorf("unsupported record type: %s", record.Type())
+	}
+}
+
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// ExportWARC writes the raw HTML of the archived pages, restricted to the
+// named collection unless it is empty, to a WARC file. They are written as
+// resource records, since the HTTP headers they were served with are not
+// kept. Files ending in .gz are compressed. It returns the number of pages
+// written.
+func (e *DocuEngine) ExportWARC(ctx context.Context, path string, collection string) (written int, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	writer := warc.NewWriter(f, strings.HasSuffix(path, ".gz"))
+
+	info := warc.NewRecord(warc.Warcinfo)
+	info.Header.Set("WARC-Filename", filepath.Base(path))
+	info.Header.Set("Content-Type", "application/warc-fields")
+	info.Content = []byte("software: DocuStore\r\nformat: WARC File Format 1.1\r\n")
+	err = writer.WriteRecord(info)
+	if err != nil {
+		return 0, err
+	}
+
+	err = EachSnapshot(e.db, collection, func(docID string, url string, timestamp int64, html []byte) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		record := warc.NewRecord(warc.Resource)
+		record.Header.Set("WARC-Target-URI", url)
+		record.Header.Set("WARC-Date", time.Unix(timestamp, 0).UTC().Format(time.RFC3339))
+		// the charset is declared by the page itself, if at all
+		record.Header.Set("Content-Type", "text/html")
+		record.Content = html
+		err := writer.WriteRecord(record)
+		if err == nil {
+			written++
+		}
+		return err
+	})
+	return written, err
+}
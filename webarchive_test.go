@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"DocuStore/warc"
+)
+
+func TestWARCRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	engine := openTestEngine(t)
+	pages := map[string]string{
+		"https://example.com/a": `<html><head><title>Page A</title><script>x()</script></head><body><p>first archived page</p></body></html>`,
+		"https://example.com/b": `<html><head><title>Page B</title></head><body><p>second archived page</p></body></html>`,
+	}
+	for url, html := range pages {
+		_, err := engine.AddHTML(ctx, []byte(html), url)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "export.warc.gz")
+	written, err := engine.ExportWARC(ctx, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != len(pages) {
+		t.Errorf("%d pages written, expected %d", written, len(pages))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader, err := warc.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := 0
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Type() != warc.Resource {
+			continue
+		}
+		records++
+		if string(record.Content) != pages[record.TargetURI()] {
+			t.Errorf("record of %s is not the raw page: %s", record.TargetURI(), record.Content)
+		}
+	}
+	if records != len(pages) {
+		t.Errorf("%d resource records, expected %d", records, len(pages))
+	}
+
+	imported := openTestEngine(t)
+	added, duplicates, err := imported.ImportWARC(ctx, path, "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != len(pages) || duplicates != 0 {
+		t.Errorf("%d pages imported and %d duplicates, expected %d and 0", added, duplicates, len(pages))
+	}
+	// importing the same file again only finds duplicates
+	added, duplicates, err = imported.ImportWARC(ctx, path, "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 0 || duplicates != len(pages) {
+		t.Errorf("%d pages imported again and %d duplicates, expected 0 and %d", added, duplicates, len(pages))
+	}
+	results, err := imported.QueryDocument(ctx, "second archived")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || results[0].Title != "Page B" {
+		t.Errorf("imported pages not found: %v", results)
+	}
+
+	_, err = engine.ExportWARC(ctx, filepath.Join(t.TempDir(), "missing", "export.warc"), "")
+	if err == nil {
+		t.Error("exporting to a missing folder succeeded")
+	}
+}